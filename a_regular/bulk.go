@@ -0,0 +1,56 @@
+package skiplist
+
+// FromSorted builds a list holding keys[i] -> values[i] in O(n), without the
+// predecessor search that every Set does. Keys must be in ascending order,
+// strictly so unless AllowDuplicates is given; FromSorted panics otherwise.
+// Node levels are drawn exactly as repeated Set calls would draw them.
+func FromSorted[K, V any](compare func(a, b K) int, keys []K, values []V, opts ...Option) *SkipList[K, V] {
+	if len(keys) != len(values) {
+		panic("skiplist: keys and values differ in length")
+	}
+	sl := New[K, V](compare, opts...)
+
+	// last[i] is the rightmost node linked so far at level i, and pos[i] its
+	// position, so each new node is appended to the end of its levels.
+	var last [MaxLevel]*Node[K, V]
+	var pos [MaxLevel]int
+	for i := range last {
+		last[i] = sl.head
+	}
+
+	for n, key := range keys {
+		if n > 0 {
+			c := compare(keys[n-1], key)
+			if c > 0 || (c == 0 && !sl.duplicates) {
+				panic("skiplist: keys are not sorted")
+			}
+		}
+
+		lvl := sl.randomLevel()
+		if lvl > sl.level {
+			sl.level = lvl
+		}
+
+		node := NewNode(key, values[n], lvl)
+		if last[0] != sl.head {
+			node.prev = last[0]
+		}
+		for i := 0; i < lvl; i++ {
+			last[i].next[i] = node
+			last[i].span[i] = n + 1 - pos[i]
+			last[i] = node
+			pos[i] = n + 1
+		}
+	}
+
+	sl.length = len(keys)
+	if sl.length > 0 {
+		sl.tail = last[0]
+	}
+	// Links that run off the end carry the distance to the end of the list,
+	// as Set expects when it later splits them.
+	for i := 0; i < sl.level; i++ {
+		last[i].span[i] = sl.length - pos[i]
+	}
+	return sl
+}
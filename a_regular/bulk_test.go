@@ -0,0 +1,71 @@
+package skiplist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromSorted(t *testing.T) {
+	const n = 2000
+	keys := make([]int, n)
+	values := make([]int, n)
+	for i := range keys {
+		keys[i] = i * 2
+		values[i] = i
+	}
+
+	bulk := FromSorted(intCompare, keys, values, WithLevelGenerator(NewLevelGenerator(9)))
+	checkSpans(t, bulk)
+
+	// Ascending Sets draw the same levels in the same order.
+	incremental := New[int, int](intCompare, WithLevelGenerator(NewLevelGenerator(9)))
+	for i := range keys {
+		incremental.Set(keys[i], values[i])
+	}
+	if !reflect.DeepEqual(heights(incremental), heights(bulk)) {
+		t.Errorf("Expected bulk build to match incremental heights")
+	}
+	if bulk.level != incremental.level {
+		t.Errorf("Expected: %v, Got: %v", incremental.level, bulk.level)
+	}
+
+	for i := 0; i < n; i += 97 {
+		if k, v, _ := bulk.At(i); k != keys[i] || v != values[i] {
+			t.Fatalf("At(%d): Expected: %v, Got: %v", i, keys[i], k)
+		}
+	}
+
+	// The list must stay consistent under later modification.
+	bulk.Set(3, -1)
+	bulk.Set(n*2+1, -1)
+	bulk.Delete(0)
+	bulk.Delete(n*2 - 2)
+	checkSpans(t, bulk)
+	if rank, found := bulk.Rank(3); !found || rank != 1 {
+		t.Errorf("Expected: %v, Got: %v", 1, rank)
+	}
+}
+
+func TestFromSortedEdgeCases(t *testing.T) {
+	empty := FromSorted[int, int](intCompare, nil, nil)
+	checkSpans(t, empty)
+	empty.Set(1, 1)
+	checkSpans(t, empty)
+
+	multi := FromSorted(intCompare, []int{1, 1, 2}, []int{10, 11, 20}, AllowDuplicates())
+	checkSpans(t, multi)
+	if n := multi.Count(1); n != 2 {
+		t.Errorf("Expected: %v, Got: %v", 2, n)
+	}
+
+	for _, keys := range [][]int{{2, 1}, {1, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected FromSorted(%v) to panic", keys)
+				}
+			}()
+			FromSorted(intCompare, keys, []int{0, 0})
+		}()
+	}
+}
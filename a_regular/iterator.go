@@ -0,0 +1,124 @@
+package skiplist
+
+// Iterator is a cursor over a SkipList. It is positioned on a node or is
+// invalid; an iterator that walks off either end becomes invalid. Modifying
+// the list invalidates the iterator unless the modification was the deletion
+// of a node other than the current one.
+type Iterator[K, V any] struct {
+	list *SkipList[K, V]
+	node *Node[K, V]
+}
+
+// Bound is one end of a key range passed to Range.
+type Bound[K any] struct {
+	key       K
+	inclusive bool
+	unbounded bool
+}
+
+// Inclusive returns a bound that includes key.
+func Inclusive[K any](key K) Bound[K] { return Bound[K]{key: key, inclusive: true} }
+
+// Exclusive returns a bound that excludes key.
+func Exclusive[K any](key K) Bound[K] { return Bound[K]{key: key} }
+
+// Unbounded returns a bound that does not limit the range.
+func Unbounded[K any]() Bound[K] { return Bound[K]{unbounded: true} }
+
+// Iterator returns an invalid iterator over the list. Position it with one
+// of the Seek methods.
+func (sl *SkipList[K, V]) Iterator() *Iterator[K, V] {
+	return &Iterator[K, V]{list: sl}
+}
+
+// Range calls fn for every key in [lo, hi] in ascending order, honouring the
+// inclusiveness of each bound, until fn returns false.
+func (sl *SkipList[K, V]) Range(lo, hi Bound[K], fn func(key K, value V) bool) {
+	var x *Node[K, V]
+	if lo.unbounded {
+		x = sl.head.next[0]
+	} else {
+		x = sl.seekGreater(lo.key, !lo.inclusive)
+	}
+	for ; x != nil; x = x.next[0] {
+		if !hi.unbounded {
+			c := sl.compare(x.key, hi.key)
+			if c > 0 || (c == 0 && !hi.inclusive) {
+				return
+			}
+		}
+		if !fn(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// seekGreater returns the first node whose key is >= key, or > key when
+// strict is set.
+func (sl *SkipList[K, V]) seekGreater(key K, strict bool) *Node[K, V] {
+	current := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for next := current.next[i]; next != nil; next = current.next[i] {
+			c := sl.compare(next.key, key)
+			if c > 0 || (c == 0 && !strict) {
+				break
+			}
+			current = next
+		}
+	}
+	return current.next[0]
+}
+
+// seekLess returns the last node whose key is <= key, or < key when strict
+// is set.
+func (sl *SkipList[K, V]) seekLess(key K, strict bool) *Node[K, V] {
+	current := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for next := current.next[i]; next != nil; next = current.next[i] {
+			c := sl.compare(next.key, key)
+			if c > 0 || (c == 0 && strict) {
+				break
+			}
+			current = next
+		}
+	}
+	if current == sl.head {
+		return nil
+	}
+	return current
+}
+
+// Valid returns true iff the iterator is positioned at a node.
+func (it *Iterator[K, V]) Valid() bool { return it.node != nil }
+
+// Key returns the key at the current position.
+func (it *Iterator[K, V]) Key() K { return it.node.key }
+
+// Value returns the value at the current position.
+func (it *Iterator[K, V]) Value() V { return it.node.value }
+
+// Next advances to the next position.
+func (it *Iterator[K, V]) Next() { it.node = it.node.next[0] }
+
+// Prev moves to the previous position.
+func (it *Iterator[K, V]) Prev() { it.node = it.node.prev }
+
+// Seek positions the iterator on the first key >= key and reports whether it
+// is equal to key.
+func (it *Iterator[K, V]) Seek(key K) (found bool) {
+	it.node = it.list.seekGreater(key, false)
+	return it.node != nil && it.list.compare(it.node.key, key) == 0
+}
+
+// SeekForPrev positions the iterator on the last key <= key and reports
+// whether it is equal to key.
+func (it *Iterator[K, V]) SeekForPrev(key K) (found bool) {
+	it.node = it.list.seekLess(key, false)
+	return it.node != nil && it.list.compare(it.node.key, key) == 0
+}
+
+// SeekToFirst positions the iterator on the first key, if any.
+func (it *Iterator[K, V]) SeekToFirst() { it.node = it.list.head.next[0] }
+
+// SeekToLast positions the iterator on the last key, if any.
+func (it *Iterator[K, V]) SeekToLast() { it.node = it.list.tail }
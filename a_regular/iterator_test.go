@@ -0,0 +1,113 @@
+package skiplist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestList(keys ...int) *SkipList[int, int] {
+	sl := New[int, int](intCompare)
+	for _, k := range keys {
+		sl.Set(k, k*10)
+	}
+	return sl
+}
+
+func collectRange(sl *SkipList[int, int], lo, hi Bound[int]) []int {
+	var keys []int
+	sl.Range(lo, hi, func(k, v int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+func TestRange(t *testing.T) {
+	sl := newTestList(1, 3, 5, 7, 9)
+
+	tests := []struct {
+		lo, hi   Bound[int]
+		expected []int
+	}{
+		{Inclusive(3), Inclusive(7), []int{3, 5, 7}},
+		{Exclusive(3), Exclusive(7), []int{5}},
+		{Inclusive(2), Exclusive(9), []int{3, 5, 7}},
+		{Unbounded[int](), Exclusive(5), []int{1, 3}},
+		{Exclusive(5), Unbounded[int](), []int{7, 9}},
+		{Unbounded[int](), Unbounded[int](), []int{1, 3, 5, 7, 9}},
+		{Inclusive(10), Unbounded[int](), nil},
+		{Exclusive(5), Exclusive(5), nil},
+	}
+	for _, tt := range tests {
+		if got := collectRange(sl, tt.lo, tt.hi); !reflect.DeepEqual(tt.expected, got) {
+			t.Errorf("Range(%+v, %+v): Expected: %v, Got: %v", tt.lo, tt.hi, tt.expected, got)
+		}
+	}
+
+	var keys []int
+	sl.Range(Unbounded[int](), Unbounded[int](), func(k, v int) bool {
+		keys = append(keys, k)
+		return len(keys) < 2
+	})
+	if !reflect.DeepEqual([]int{1, 3}, keys) {
+		t.Errorf("Expected: %v, Got: %v", []int{1, 3}, keys)
+	}
+}
+
+func TestIteratorSeek(t *testing.T) {
+	sl := newTestList(1, 3, 5, 7)
+	it := sl.Iterator()
+	if it.Valid() {
+		t.Errorf("Expected new iterator to be invalid")
+	}
+
+	if !it.Seek(3) || it.Key() != 3 || it.Value() != 30 {
+		t.Errorf("Seek(3): Got: %v", it.Key())
+	}
+	if it.Seek(4) || it.Key() != 5 {
+		t.Errorf("Seek(4): Got: %v", it.Key())
+	}
+	if it.Seek(8) || it.Valid() {
+		t.Errorf("Expected Seek(8) to be invalid")
+	}
+
+	if !it.SeekForPrev(5) || it.Key() != 5 {
+		t.Errorf("SeekForPrev(5): Got: %v", it.Key())
+	}
+	if it.SeekForPrev(4) || it.Key() != 3 {
+		t.Errorf("SeekForPrev(4): Got: %v", it.Key())
+	}
+	if it.SeekForPrev(0) || it.Valid() {
+		t.Errorf("Expected SeekForPrev(0) to be invalid")
+	}
+}
+
+func TestIteratorBothDirections(t *testing.T) {
+	sl := newTestList(5, 1, 7, 3, 9)
+	sl.Delete(9)
+	sl.Delete(1)
+	checkSpans(t, sl)
+
+	var forward, backward []int
+	it := sl.Iterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		forward = append(forward, it.Key())
+	}
+	for it.SeekToLast(); it.Valid(); it.Prev() {
+		backward = append(backward, it.Key())
+	}
+	if !reflect.DeepEqual([]int{3, 5, 7}, forward) {
+		t.Errorf("Expected: %v, Got: %v", []int{3, 5, 7}, forward)
+	}
+	if !reflect.DeepEqual([]int{7, 5, 3}, backward) {
+		t.Errorf("Expected: %v, Got: %v", []int{7, 5, 3}, backward)
+	}
+
+	sl.Delete(3)
+	sl.Delete(5)
+	sl.Delete(7)
+	it.SeekToLast()
+	if it.Valid() {
+		t.Errorf("Expected empty list to have no last node")
+	}
+}
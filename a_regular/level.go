@@ -0,0 +1,33 @@
+package skiplist
+
+import "math/rand"
+
+// LevelGenerator returns the level of the next node to be inserted. Results
+// outside [1, MaxLevel] are clamped.
+type LevelGenerator func() int
+
+// WithLevelGenerator makes the list draw node levels from g instead of the
+// global math/rand source.
+func WithLevelGenerator(g LevelGenerator) Option {
+	return func(o *options) { o.levels = g }
+}
+
+// NewLevelGenerator returns a LevelGenerator with the default distribution,
+// driven by its own source seeded with seed, so that the shape of a list can
+// be replayed exactly.
+func NewLevelGenerator(seed int64) LevelGenerator {
+	rng := rand.New(rand.NewSource(seed))
+	return func() int { return geometricLevel(rng.Float32) }
+}
+
+func defaultLevel() int {
+	return geometricLevel(rand.Float32)
+}
+
+func geometricLevel(next func() float32) int {
+	lvl := 1
+	for next() < Probability && lvl < MaxLevel {
+		lvl++
+	}
+	return lvl
+}
@@ -0,0 +1,53 @@
+package skiplist
+
+import "testing"
+
+func heights(sl *SkipList[int, int]) []int {
+	var out []int
+	for n := sl.head.next[0]; n != nil; n = n.next[0] {
+		out = append(out, len(n.next))
+	}
+	return out
+}
+
+func TestSeededLevelGenerator(t *testing.T) {
+	build := func() *SkipList[int, int] {
+		sl := New[int, int](intCompare, WithLevelGenerator(NewLevelGenerator(42)))
+		for i := 0; i < 1000; i++ {
+			sl.Set((i*7919)%1000, i)
+		}
+		return sl
+	}
+	a, b := heights(build()), heights(build())
+	if len(a) != 1000 {
+		t.Fatalf("Expected: %v, Got: %v", 1000, len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("node %d: Expected: %v, Got: %v", i, a[i], b[i])
+		}
+	}
+}
+
+func TestCustomLevelGenerator(t *testing.T) {
+	// Adversarial sequence that alternates between out of range levels.
+	levels := []int{0, MaxLevel + 5, 3}
+	i := 0
+	sl := New[int, int](intCompare, WithLevelGenerator(func() int {
+		lvl := levels[i%len(levels)]
+		i++
+		return lvl
+	}))
+	for k := 0; k < 6; k++ {
+		sl.Set(k, k)
+	}
+	checkSpans(t, sl)
+
+	expected := []int{1, MaxLevel, 3, 1, MaxLevel, 3}
+	got := heights(sl)
+	for k := range expected {
+		if got[k] != expected[k] {
+			t.Fatalf("Expected: %v, Got: %v", expected, got)
+		}
+	}
+}
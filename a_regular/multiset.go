@@ -0,0 +1,34 @@
+package skiplist
+
+// Count returns the number of entries whose key equals key. It is at most one
+// unless the list allows duplicates.
+func (sl *SkipList[K, V]) Count(key K) int {
+	before, _ := sl.rank(key, false)
+	through, _ := sl.rank(key, true)
+	return through - before
+}
+
+// DeleteOne removes the oldest entry whose key equals key and returns its
+// value.
+func (sl *SkipList[K, V]) DeleteOne(key K) (value V, ok bool) {
+	return sl.Delete(key)
+}
+
+// DeleteAll removes every entry whose key equals key and returns how many
+// were removed.
+func (sl *SkipList[K, V]) DeleteAll(key K) int {
+	update := make([]*Node[K, V], MaxLevel)
+	rank := make([]int, MaxLevel)
+
+	// The predecessors of the first equal entry stay the predecessors of
+	// each following one as the run is unlinked front to back.
+	current := sl.findPredecessors(key, false, update, rank)
+	n := 0
+	for current != nil && sl.compare(current.key, key) == 0 {
+		next := current.next[0]
+		sl.deleteNode(current, update)
+		current = next
+		n++
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+package skiplist
+
+import (
+	"reflect"
+	"testing"
+)
+
+type entry struct {
+	key   int
+	value string
+}
+
+func entries(sl *SkipList[int, string]) []entry {
+	var out []entry
+	sl.Range(Unbounded[int](), Unbounded[int](), func(k int, v string) bool {
+		out = append(out, entry{k, v})
+		return true
+	})
+	return out
+}
+
+func TestMultisetInsertionOrder(t *testing.T) {
+	sl := New[int, string](intCompare, AllowDuplicates())
+	sl.Set(2, "a")
+	sl.Set(1, "b")
+	sl.Set(2, "c")
+	sl.Set(3, "d")
+	sl.Set(2, "e")
+	checkSpans(t, sl)
+
+	expected := []entry{{1, "b"}, {2, "a"}, {2, "c"}, {2, "e"}, {3, "d"}}
+	if got := entries(sl); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+	if sl.Len() != 5 {
+		t.Errorf("Expected: %v, Got: %v", 5, sl.Len())
+	}
+	if v, _ := sl.Get(2); v != "a" {
+		t.Errorf("Expected: %v, Got: %v", "a", v)
+	}
+	if rank, found := sl.Rank(3); !found || rank != 4 {
+		t.Errorf("Expected: %v, Got: %v", 4, rank)
+	}
+
+	var backward []string
+	it := sl.Iterator()
+	for it.SeekForPrev(2); it.Valid() && it.Key() == 2; it.Prev() {
+		backward = append(backward, it.Value())
+	}
+	if !reflect.DeepEqual([]string{"e", "c", "a"}, backward) {
+		t.Errorf("Expected: %v, Got: %v", []string{"e", "c", "a"}, backward)
+	}
+}
+
+func TestMultisetCountAndDelete(t *testing.T) {
+	sl := New[int, string](intCompare, AllowDuplicates())
+	for _, v := range []string{"a", "b", "c", "d"} {
+		sl.Set(5, v)
+	}
+	sl.Set(4, "x")
+	sl.Set(6, "y")
+
+	if n := sl.Count(5); n != 4 {
+		t.Errorf("Expected: %v, Got: %v", 4, n)
+	}
+	if n := sl.Count(7); n != 0 {
+		t.Errorf("Expected: %v, Got: %v", 0, n)
+	}
+
+	if v, ok := sl.DeleteOne(5); !ok || v != "a" {
+		t.Errorf("Expected: %v, Got: %v", "a", v)
+	}
+	checkSpans(t, sl)
+	if n := sl.Count(5); n != 3 {
+		t.Errorf("Expected: %v, Got: %v", 3, n)
+	}
+
+	if n := sl.DeleteAll(5); n != 3 {
+		t.Errorf("Expected: %v, Got: %v", 3, n)
+	}
+	checkSpans(t, sl)
+	expected := []entry{{4, "x"}, {6, "y"}}
+	if got := entries(sl); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+	if n := sl.DeleteAll(5); n != 0 {
+		t.Errorf("Expected: %v, Got: %v", 0, n)
+	}
+}
+
+func TestUniqueCount(t *testing.T) {
+	sl := New[int, string](intCompare)
+	sl.Set(1, "a")
+	sl.Set(1, "b")
+	if n := sl.Count(1); n != 1 {
+		t.Errorf("Expected: %v, Got: %v", 1, n)
+	}
+	if n := sl.DeleteAll(1); n != 1 {
+		t.Errorf("Expected: %v, Got: %v", 1, n)
+	}
+}
@@ -0,0 +1,79 @@
+package skiplist
+
+// Positional queries use the span stored next to every link: walking right
+// along next[i] advances the position by span[i], so the position of any node
+// is the sum of the spans crossed on the way down to it. This is the
+// indexable skip list used by Redis sorted sets.
+
+// Rank returns the number of keys strictly less than key, which is also the
+// zero based index key has (or would have) in the list.
+func (sl *SkipList[K, V]) Rank(key K) (rank int, found bool) {
+	rank, current := sl.rank(key, false)
+	return rank, current != nil && sl.compare(current.key, key) == 0
+}
+
+// rank returns the number of keys < key, or <= key when after is set,
+// together with the node that follows them.
+func (sl *SkipList[K, V]) rank(key K, after bool) (rank int, next *Node[K, V]) {
+	limit := 0
+	if after {
+		limit = 1
+	}
+	current := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && sl.compare(current.next[i].key, key) < limit {
+			rank += current.span[i]
+			current = current.next[i]
+		}
+	}
+	return rank, current.next[0]
+}
+
+// At returns the key and value at the zero based index.
+func (sl *SkipList[K, V]) At(index int) (key K, value V, ok bool) {
+	if index < 0 || index >= sl.length {
+		return key, value, false
+	}
+	x := sl.nodeAt(index)
+	return x.key, x.value, true
+}
+
+// DeleteAt removes the element at the zero based index and returns it.
+func (sl *SkipList[K, V]) DeleteAt(index int) (key K, value V, ok bool) {
+	if index < 0 || index >= sl.length {
+		return key, value, false
+	}
+	update := make([]*Node[K, V], MaxLevel)
+
+	// Stop one position short at every level to collect the predecessors.
+	current := sl.head
+	traversed := 0
+	for i := sl.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && traversed+current.span[i] <= index {
+			traversed += current.span[i]
+			current = current.next[i]
+		}
+		update[i] = current
+	}
+	x := current.next[0]
+	sl.deleteNode(x, update)
+	return x.key, x.value, true
+}
+
+// nodeAt returns the node at index, which must be within bounds.
+func (sl *SkipList[K, V]) nodeAt(index int) *Node[K, V] {
+	// The head sits at position 0, so the element at index is at index+1.
+	target := index + 1
+	current := sl.head
+	traversed := 0
+	for i := sl.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && traversed+current.span[i] <= target {
+			traversed += current.span[i]
+			current = current.next[i]
+		}
+		if traversed == target {
+			return current
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package skiplist
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// checkSpans verifies that every link's span matches the number of level 0
+// hops it skips over, and that the backward links mirror level 0.
+func checkSpans[K, V any](t *testing.T, sl *SkipList[K, V]) {
+	t.Helper()
+	pos := map[*Node[K, V]]int{sl.head: 0}
+	i := 0
+	var last *Node[K, V]
+	for n := sl.head.next[0]; n != nil; n = n.next[0] {
+		if n.prev != last {
+			t.Fatalf("backward link of node %d is wrong", i+1)
+		}
+		i++
+		pos[n] = i
+		last = n
+	}
+	if sl.tail != last {
+		t.Fatalf("tail is not the last node")
+	}
+	if i != sl.Len() {
+		t.Fatalf("Expected: %v, Got: %v", sl.Len(), i)
+	}
+	for n := range pos {
+		for lv := 0; lv < len(n.next) && lv < sl.level; lv++ {
+			if next := n.next[lv]; next != nil && pos[next]-pos[n] != n.span[lv] {
+				t.Fatalf("level %d span: Expected: %v, Got: %v", lv, pos[next]-pos[n], n.span[lv])
+			}
+		}
+	}
+}
+
+func TestRankAt(t *testing.T) {
+	sl := New[int, int](intCompare)
+	for i := 0; i < 100; i++ {
+		sl.Set(i*10, i)
+	}
+	checkSpans(t, sl)
+
+	for i := 0; i < 100; i++ {
+		rank, found := sl.Rank(i * 10)
+		if !found || rank != i {
+			t.Errorf("Rank(%d): Expected: %v, Got: %v %v", i*10, i, rank, found)
+		}
+		rank, found = sl.Rank(i*10 + 5)
+		if found || rank != i+1 {
+			t.Errorf("Rank(%d): Expected: %v, Got: %v %v", i*10+5, i+1, rank, found)
+		}
+		k, v, ok := sl.At(i)
+		if !ok || k != i*10 || v != i {
+			t.Errorf("At(%d): Expected: %v, Got: %v", i, i*10, k)
+		}
+	}
+	if _, _, ok := sl.At(100); ok {
+		t.Errorf("Expected At past the end to miss")
+	}
+	if _, _, ok := sl.At(-1); ok {
+		t.Errorf("Expected At(-1) to miss")
+	}
+
+	k, _, ok := sl.DeleteAt(50)
+	if !ok || k != 500 {
+		t.Errorf("Expected: %v, Got: %v", 500, k)
+	}
+	checkSpans(t, sl)
+	if k, _, _ := sl.At(50); k != 510 {
+		t.Errorf("Expected: %v, Got: %v", 510, k)
+	}
+	if _, _, ok := sl.DeleteAt(99); ok {
+		t.Errorf("Expected DeleteAt past the end to miss")
+	}
+}
+
+func TestRankRandomized(t *testing.T) {
+	sl := New[int, int](intCompare)
+	ref := map[int]bool{}
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 5000; i++ {
+		k := rng.Intn(1000)
+		switch rng.Intn(4) {
+		case 0:
+			sl.Delete(k)
+			delete(ref, k)
+		case 1:
+			if sl.Len() > 0 {
+				idx := rng.Intn(sl.Len())
+				k, _, _ := sl.DeleteAt(idx)
+				delete(ref, k)
+			}
+		default:
+			sl.Set(k, k)
+			ref[k] = true
+		}
+	}
+	checkSpans(t, sl)
+
+	keys := make([]int, 0, len(ref))
+	for k := range ref {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for i, k := range keys {
+		if got, _, _ := sl.At(i); got != k {
+			t.Fatalf("At(%d): Expected: %v, Got: %v", i, k, got)
+		}
+		if rank, _ := sl.Rank(k); rank != i {
+			t.Fatalf("Rank(%d): Expected: %v, Got: %v", k, i, rank)
+		}
+	}
+}
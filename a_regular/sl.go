@@ -1,10 +1,6 @@
-package main
-
-import (
-	"fmt"
-	"math/rand"
-	"time"
-)
+// Package skiplist is a single-threaded, probabilistic skip list that maps
+// ordered keys to values.
+package skiplist
 
 const (
 	// MaxLevel is the maximum level for the skip list
@@ -13,124 +9,223 @@ const (
 	Probability float32 = 0.5
 )
 
-type Node struct {
-	value int
-	next  []*Node
+type Node[K, V any] struct {
+	key   K
+	value V
+	next  []*Node[K, V]
+	// prev is the level 0 backward link, nil for the first node.
+	prev *Node[K, V]
+	// span[i] is the number of level 0 hops that next[i] skips over, which
+	// lets the list answer positional queries (see rank.go).
+	span []int
+}
+
+// SkipList is an ordered map from K to V, or an ordered multimap when built
+// with AllowDuplicates. It is not safe for concurrent use.
+type SkipList[K, V any] struct {
+	head       *Node[K, V]
+	tail       *Node[K, V] // Last node, nil when empty
+	level      int         // Current level of the skip list
+	length     int
+	compare    func(a, b K) int
+	duplicates bool
+	levels     LevelGenerator
 }
 
-type SkipList struct {
-	head  *Node
-	level int // Current level of the skip list
+// Option configures a SkipList at construction time.
+type Option func(*options)
+
+type options struct {
+	duplicates bool
+	levels     LevelGenerator
 }
 
-func NewNode(value, level int) *Node {
-	return &Node{
+// AllowDuplicates turns the list into a multiset: Set always inserts, and
+// equal keys are kept, and iterated, in insertion order.
+func AllowDuplicates() Option {
+	return func(o *options) { o.duplicates = true }
+}
+
+func NewNode[K, V any](key K, value V, level int) *Node[K, V] {
+	return &Node[K, V]{
+		key:   key,
 		value: value,
-		next:  make([]*Node, level),
+		next:  make([]*Node[K, V], level),
+		span:  make([]int, level),
 	}
 }
 
-func NewSkipList() *SkipList {
-	return &SkipList{
-		head:  NewNode(-1, MaxLevel),
-		level: 0,
+// New returns an empty skip list ordered by compare, which must return a
+// negative number when a < b, zero when a == b and a positive number when
+// a > b.
+func New[K, V any](compare func(a, b K) int, opts ...Option) *SkipList[K, V] {
+	o := options{levels: defaultLevel}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var key K
+	var value V
+	return &SkipList[K, V]{
+		head:       NewNode(key, value, MaxLevel),
+		level:      0,
+		compare:    compare,
+		duplicates: o.duplicates,
+		levels:     o.levels,
 	}
 }
 
-func (sl *SkipList) randomLevel() int {
-	lvl := 1
-	for rand.Float32() < Probability && lvl < MaxLevel {
-		lvl++
+// Key returns the key stored in the node.
+func (n *Node[K, V]) Key() K { return n.key }
+
+// Value returns the value stored in the node.
+func (n *Node[K, V]) Value() V { return n.value }
+
+// Len returns the number of keys in the list.
+func (sl *SkipList[K, V]) Len() int { return sl.length }
+
+func (sl *SkipList[K, V]) randomLevel() int {
+	lvl := sl.levels()
+	if lvl < 1 {
+		return 1
+	}
+	if lvl > MaxLevel {
+		return MaxLevel
 	}
 	return lvl
 }
 
-func (sl *SkipList) Insert(value int) {
-	pred := make([]*Node, MaxLevel)
+// findPredecessors fills pred with the rightmost node before key at every
+// level, and rank with the position of that node (the head is 0). It returns
+// the first node whose key is >= key. When after is set, nodes equal to key
+// count as predecessors too, so the result is the first node > key.
+func (sl *SkipList[K, V]) findPredecessors(key K, after bool, pred []*Node[K, V], rank []int) *Node[K, V] {
+	limit := 0
+	if after {
+		limit = 1
+	}
 	current := sl.head
-
-	// 1. Find the predecessors
 	for i := sl.level - 1; i >= 0; i-- {
-		// < value is important. it ensures we only get predecessors
-		for current.next[i] != nil && current.next[i].value < value {
+		if i == sl.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		// < key is important. it ensures we only get predecessors
+		for current.next[i] != nil && sl.compare(current.next[i].key, key) < limit {
+			rank[i] += current.span[i]
 			current = current.next[i]
 		}
 		pred[i] = current
 	}
+	return current.next[0]
+}
 
-	current = current.next[0]
-	if current == nil || current.value != value {
-		lvl := sl.randomLevel()
-
-		// Corner Case: fill the new higher levels with value as head.
-		if lvl > sl.level {
-			for i := sl.level; i < lvl; i++ {
-				pred[i] = sl.head
-			}
-			sl.level = lvl
-		}
+// Set stores value under key. If the key was already present its value is
+// replaced and the previous value is returned with replaced set to true.
+// Lists that allow duplicates never replace: the new entry is placed after
+// all existing entries with an equal key.
+func (sl *SkipList[K, V]) Set(key K, value V) (old V, replaced bool) {
+	pred := make([]*Node[K, V], MaxLevel)
+	rank := make([]int, MaxLevel)
 
-		// 3. Link the new node
-		newNode := NewNode(value, lvl)
-		for i := 0; i < lvl; i++ {
-			// kind of like linked list remove/update element
-			newNode.next[i] = pred[i].next[i]
-			pred[i].next[i] = newNode
+	// 1. Find the predecessors
+	current := sl.findPredecessors(key, sl.duplicates, pred, rank)
+
+	// 2. Overwrite in place if the key is already there
+	if !sl.duplicates && current != nil && sl.compare(current.key, key) == 0 {
+		old = current.value
+		current.value = value
+		return old, true
+	}
+
+	lvl := sl.randomLevel()
+
+	// Corner Case: fill the new higher levels with value as head.
+	if lvl > sl.level {
+		for i := sl.level; i < lvl; i++ {
+			rank[i] = 0
+			pred[i] = sl.head
+			pred[i].span[i] = sl.length
 		}
+		sl.level = lvl
+	}
+
+	// 3. Link the new node
+	newNode := NewNode(key, value, lvl)
+	for i := 0; i < lvl; i++ {
+		// kind of like linked list remove/update element
+		newNode.next[i] = pred[i].next[i]
+		pred[i].next[i] = newNode
+
+		// split the predecessor's span around the new node
+		newNode.span[i] = pred[i].span[i] - (rank[0] - rank[i])
+		pred[i].span[i] = rank[0] - rank[i] + 1
+	}
+	if pred[0] != sl.head {
+		newNode.prev = pred[0]
 	}
+	if newNode.next[0] != nil {
+		newNode.next[0].prev = newNode
+	} else {
+		sl.tail = newNode
+	}
+
+	// untouched levels above the new node now skip over one more node
+	for i := lvl; i < sl.level; i++ {
+		pred[i].span[i]++
+	}
+	sl.length++
+	return old, false
 }
 
-func (sl *SkipList) Delete(value int) {
-	update := make([]*Node, MaxLevel)
-	current := sl.head
+// Delete removes key from the list and returns the value it held. With
+// duplicates it behaves like DeleteOne.
+func (sl *SkipList[K, V]) Delete(key K) (value V, ok bool) {
+	update := make([]*Node[K, V], MaxLevel)
+	rank := make([]int, MaxLevel)
 
-	for i := sl.level - 1; i >= 0; i-- {
-		for current.next[i] != nil && current.next[i].value < value {
-			current = current.next[i]
-		}
-		update[i] = current
+	current := sl.findPredecessors(key, false, update, rank)
+	if current == nil || sl.compare(current.key, key) != 0 {
+		return value, false
 	}
+	sl.deleteNode(current, update)
+	return current.value, true
+}
 
-	current = current.next[0]
-	if current != nil && current.value == value {
-		for i := 0; i < sl.level; i++ {
-			if update[i].next[i] != current {
-				break
-			}
+// deleteNode unlinks x given its predecessors at every level.
+func (sl *SkipList[K, V]) deleteNode(x *Node[K, V], update []*Node[K, V]) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].next[i] == x {
 			// linkedin list delete
-			update[i].next[i] = current.next[i]
-		}
-		for sl.level > 1 && sl.head.next[sl.level-1] == nil {
-			sl.level--
+			update[i].span[i] += x.span[i] - 1
+			update[i].next[i] = x.next[i]
+		} else {
+			update[i].span[i]--
 		}
 	}
+	if x.next[0] != nil {
+		x.next[0].prev = x.prev
+	} else {
+		sl.tail = x.prev
+	}
+	for sl.level > 1 && sl.head.next[sl.level-1] == nil {
+		sl.level--
+	}
+	sl.length--
 }
 
-func (sl *SkipList) Search(value int) bool {
+// Get returns the value stored under key. With duplicates it returns the
+// oldest entry.
+func (sl *SkipList[K, V]) Get(key K) (value V, ok bool) {
 	current := sl.head
 	for i := sl.level - 1; i >= 0; i-- {
-		for current.next[i] != nil && current.next[i].value < value {
+		for current.next[i] != nil && sl.compare(current.next[i].key, key) < 0 {
 			current = current.next[i]
 		}
 	}
 	current = current.next[0]
-	return current != nil && current.value == value
-}
-
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	sl := NewSkipList()
-	sl.Insert(3)
-	sl.Insert(6)
-	sl.Insert(7)
-	sl.Insert(9)
-	sl.Insert(12)
-	sl.Insert(19)
-	sl.Insert(17)
-
-	fmt.Println("Search for 6:", sl.Search(6))
-	fmt.Println("Search for 15:", sl.Search(15))
-
-	sl.Delete(6)
-	fmt.Println("Search for 6 after deletion:", sl.Search(6))
+	if current != nil && sl.compare(current.key, key) == 0 {
+		return current.value, true
+	}
+	return value, false
 }
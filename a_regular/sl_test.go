@@ -0,0 +1,108 @@
+package skiplist
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func intCompare(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func TestSetGetDelete(t *testing.T) {
+	sl := New[int, string](intCompare)
+
+	if _, replaced := sl.Set(1, "one"); replaced {
+		t.Errorf("Expected first Set to insert")
+	}
+	sl.Set(3, "three")
+	sl.Set(2, "two")
+	if sl.Len() != 3 {
+		t.Errorf("Expected: %v, Got: %v", 3, sl.Len())
+	}
+
+	old, replaced := sl.Set(2, "TWO")
+	if !replaced || old != "two" {
+		t.Errorf("Expected: %v, Got: %v (replaced=%v)", "two", old, replaced)
+	}
+	if sl.Len() != 3 {
+		t.Errorf("Expected: %v, Got: %v", 3, sl.Len())
+	}
+	if v, ok := sl.Get(2); !ok || v != "TWO" {
+		t.Errorf("Expected: %v, Got: %v", "TWO", v)
+	}
+
+	if v, ok := sl.Delete(1); !ok || v != "one" {
+		t.Errorf("Expected: %v, Got: %v", "one", v)
+	}
+	if _, ok := sl.Delete(1); ok {
+		t.Errorf("Expected second Delete to miss")
+	}
+	if _, ok := sl.Get(1); ok {
+		t.Errorf("Expected deleted key to be absent")
+	}
+	if sl.Len() != 2 {
+		t.Errorf("Expected: %v, Got: %v", 2, sl.Len())
+	}
+}
+
+func TestRandomized(t *testing.T) {
+	sl := New[int, int](intCompare)
+	ref := map[int]int{}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		k := rng.Intn(500)
+		if rng.Intn(3) == 0 {
+			v, ok := sl.Delete(k)
+			rv, rok := ref[k]
+			if ok != rok || v != rv {
+				t.Fatalf("Delete(%d): Expected: %v %v, Got: %v %v", k, rv, rok, v, ok)
+			}
+			delete(ref, k)
+		} else {
+			sl.Set(k, i)
+			ref[k] = i
+		}
+		if sl.Len() != len(ref) {
+			t.Fatalf("Expected: %v, Got: %v", len(ref), sl.Len())
+		}
+	}
+	prev := -1
+	for n := sl.head.next[0]; n != nil; n = n.next[0] {
+		if n.key <= prev {
+			t.Fatalf("not sorted: %d after %d", n.key, prev)
+		}
+		if ref[n.key] != n.value {
+			t.Fatalf("Expected: %v, Got: %v", ref[n.key], n.value)
+		}
+		prev = n.key
+	}
+}
+
+func Example() {
+	sl := New[int, string](func(a, b int) int { return a - b })
+	for _, k := range []int{3, 6, 7, 9, 12, 19, 17} {
+		sl.Set(k, fmt.Sprint("v", k))
+	}
+
+	_, ok := sl.Get(6)
+	fmt.Println("Search for 6:", ok)
+	_, ok = sl.Get(15)
+	fmt.Println("Search for 15:", ok)
+
+	sl.Delete(6)
+	_, ok = sl.Get(6)
+	fmt.Println("Search for 6 after deletion:", ok)
+	// Output:
+	// Search for 6: true
+	// Search for 15: false
+	// Search for 6 after deletion: false
+}
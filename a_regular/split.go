@@ -0,0 +1,147 @@
+package skiplist
+
+// Split cuts the list in two in O(log n) without copying any node. The list
+// keeps the keys < key and is returned as left; the keys >= key move to the
+// new list right, which shares the list's comparator and options.
+func (sl *SkipList[K, V]) Split(key K) (left, right *SkipList[K, V]) {
+	return sl, sl.split(key, false)
+}
+
+// split moves every key >= key, or > key when after is set, into a new list.
+func (sl *SkipList[K, V]) split(key K, after bool) *SkipList[K, V] {
+	pred := make([]*Node[K, V], MaxLevel)
+	rank := make([]int, MaxLevel)
+	first := sl.findPredecessors(key, after, pred, rank)
+
+	right := sl.empty()
+	if first == nil {
+		return right
+	}
+
+	// pred[i] is the last node kept at level i, so the new head takes over
+	// its outgoing link. rank[0] nodes stay behind, which shifts every
+	// position in right down by that much.
+	cut := rank[0]
+	for i := 0; i < sl.level; i++ {
+		right.head.next[i] = pred[i].next[i]
+		right.head.span[i] = pred[i].span[i] - (cut - rank[i])
+		pred[i].next[i] = nil
+		pred[i].span[i] = cut - rank[i]
+	}
+	right.level = sl.level
+	right.length = sl.length - cut
+	right.tail = sl.tail
+	first.prev = nil
+
+	sl.length = cut
+	sl.tail = pred[0]
+	if sl.tail == sl.head {
+		sl.tail = nil
+	}
+	sl.trimLevel()
+	right.trimLevel()
+	return right
+}
+
+// Concat appends other to the list in O(log n). Every key in other must be
+// greater than every key in the list (or not less, when duplicates are
+// allowed); Concat panics otherwise. other is left empty.
+func (sl *SkipList[K, V]) Concat(other *SkipList[K, V]) {
+	if other.length == 0 {
+		return
+	}
+	if sl.tail != nil {
+		c := sl.compare(sl.tail.key, other.head.next[0].key)
+		if c > 0 || (c == 0 && !sl.duplicates) {
+			panic("skiplist: concatenated lists overlap")
+		}
+	}
+
+	level := sl.level
+	if other.level > level {
+		level = other.level
+	}
+
+	// Walk down the right edge of the list to find the last node, and its
+	// position, at every level. Levels the list does not use end at head.
+	last := make([]*Node[K, V], MaxLevel)
+	rank := make([]int, MaxLevel)
+	current, pos := sl.head, 0
+	for i := level - 1; i >= 0; i-- {
+		if i < sl.level {
+			for current.next[i] != nil {
+				pos += current.span[i]
+				current = current.next[i]
+			}
+		}
+		last[i] = current
+		rank[i] = pos
+	}
+
+	for i := 0; i < level; i++ {
+		if i < other.level {
+			last[i].next[i] = other.head.next[i]
+			last[i].span[i] = sl.length - rank[i] + other.head.span[i]
+		} else {
+			last[i].span[i] = sl.length - rank[i] + other.length
+		}
+	}
+	if sl.tail != nil {
+		other.head.next[0].prev = sl.tail
+	}
+	sl.tail = other.tail
+	sl.length += other.length
+	sl.level = level
+
+	*other = *other.empty()
+}
+
+// Merge moves every entry of other into the list, leaving other empty. When
+// both lists hold a key, the value from other wins; with duplicates allowed
+// both entries are kept, the list's own ones first. Runs of keys that do not
+// interleave are moved with Split and Concat, so merging lists with disjoint
+// or coarsely interleaved ranges costs far less than re-inserting.
+func (sl *SkipList[K, V]) Merge(other *SkipList[K, V]) {
+	out := sl.empty()
+	x := sl.empty()
+	*x = *sl
+	y := other
+	for x.length > 0 && y.length > 0 {
+		fx, fy := x.head.next[0].key, y.head.next[0].key
+		c := sl.compare(fx, fy)
+		switch {
+		case c == 0 && !sl.duplicates:
+			x.DeleteAt(0)
+		case c <= 0:
+			rest := x.split(fy, sl.duplicates)
+			out.Concat(x)
+			x = rest
+		default:
+			rest := y.split(fx, false)
+			out.Concat(y)
+			*y = *rest
+		}
+	}
+	out.Concat(x)
+	out.Concat(y)
+	*sl = *out
+}
+
+// empty returns a new, empty list configured like sl.
+func (sl *SkipList[K, V]) empty() *SkipList[K, V] {
+	var key K
+	var value V
+	return &SkipList[K, V]{
+		head:       NewNode(key, value, MaxLevel),
+		compare:    sl.compare,
+		duplicates: sl.duplicates,
+		levels:     sl.levels,
+	}
+}
+
+// trimLevel drops empty levels from the top of the list.
+func (sl *SkipList[K, V]) trimLevel() {
+	for sl.level > 0 && sl.head.next[sl.level-1] == nil {
+		sl.level--
+	}
+}
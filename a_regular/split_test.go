@@ -0,0 +1,172 @@
+package skiplist
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func keysOf[V any](sl *SkipList[int, V]) []int {
+	var keys []int
+	it := sl.Iterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+func TestSplit(t *testing.T) {
+	for _, at := range []int{-1, 0, 1, 50, 51, 99, 100, 200} {
+		sl := New[int, int](intCompare)
+		for i := 0; i < 100; i++ {
+			sl.Set(i, i)
+		}
+		left, right := sl.Split(at)
+		if left != sl {
+			t.Fatalf("Expected Split to keep the left half in place")
+		}
+		checkSpans(t, left)
+		checkSpans(t, right)
+
+		cut := at
+		if cut < 0 {
+			cut = 0
+		}
+		if cut > 100 {
+			cut = 100
+		}
+		if left.Len() != cut || right.Len() != 100-cut {
+			t.Fatalf("Split(%d): Expected: %v/%v, Got: %v/%v", at, cut, 100-cut, left.Len(), right.Len())
+		}
+		if right.Len() > 0 {
+			if k, _, _ := right.At(0); k != cut {
+				t.Errorf("Split(%d): Expected: %v, Got: %v", at, cut, k)
+			}
+		}
+
+		// Both halves keep working as ordinary lists.
+		left.Set(-5, 0)
+		right.Set(500, 0)
+		checkSpans(t, left)
+		checkSpans(t, right)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	a := newTestList(1, 2, 3)
+	b := newTestList(4, 5, 6, 7, 8, 9, 10)
+	a.Concat(b)
+	checkSpans(t, a)
+	checkSpans(t, b)
+	if expected := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(expected, keysOf(a)) {
+		t.Errorf("Expected: %v, Got: %v", expected, keysOf(a))
+	}
+	if b.Len() != 0 {
+		t.Errorf("Expected: %v, Got: %v", 0, b.Len())
+	}
+
+	empty := New[int, int](intCompare)
+	empty.Concat(a)
+	checkSpans(t, empty)
+	if empty.Len() != 10 {
+		t.Errorf("Expected: %v, Got: %v", 10, empty.Len())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected overlapping Concat to panic")
+		}
+	}()
+	empty.Concat(newTestList(10, 11))
+}
+
+func TestSplitConcatRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	sl := New[int, int](intCompare)
+	for i := 0; i < 1000; i++ {
+		sl.Set(rng.Intn(5000), i)
+	}
+	expected := keysOf(sl)
+	for i := 0; i < 50; i++ {
+		_, right := sl.Split(rng.Intn(5000))
+		sl.Concat(right)
+		checkSpans(t, sl)
+	}
+	if !reflect.DeepEqual(expected, keysOf(sl)) {
+		t.Errorf("Expected round trips to preserve the contents")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := New[int, string](intCompare)
+	b := New[int, string](intCompare)
+	for _, k := range []int{1, 2, 3, 10, 11, 20} {
+		a.Set(k, "a")
+	}
+	for _, k := range []int{3, 4, 5, 12, 20, 30} {
+		b.Set(k, "b")
+	}
+	a.Merge(b)
+	checkSpans(t, a)
+	checkSpans(t, b)
+
+	expected := []int{1, 2, 3, 4, 5, 10, 11, 12, 20, 30}
+	if !reflect.DeepEqual(expected, keysOf(a)) {
+		t.Errorf("Expected: %v, Got: %v", expected, keysOf(a))
+	}
+	if v, _ := a.Get(3); v != "b" {
+		t.Errorf("Expected: %v, Got: %v", "b", v)
+	}
+	if v, _ := a.Get(20); v != "b" {
+		t.Errorf("Expected: %v, Got: %v", "b", v)
+	}
+	if b.Len() != 0 {
+		t.Errorf("Expected: %v, Got: %v", 0, b.Len())
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	a := New[int, string](intCompare, AllowDuplicates())
+	b := New[int, string](intCompare, AllowDuplicates())
+	a.Set(1, "a1")
+	a.Set(2, "a2")
+	a.Set(2, "a2'")
+	b.Set(2, "b2")
+	b.Set(0, "b0")
+	a.Merge(b)
+	checkSpans(t, a)
+
+	expected := []entry{{0, "b0"}, {1, "a1"}, {2, "a2"}, {2, "a2'"}, {2, "b2"}}
+	if got := entries(a); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+}
+
+func TestMergeRandomized(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for round := 0; round < 20; round++ {
+		a := New[int, int](intCompare)
+		b := New[int, int](intCompare)
+		ref := map[int]int{}
+		for i := 0; i < 300; i++ {
+			k := rng.Intn(1000)
+			a.Set(k, 1)
+			ref[k] = 1
+		}
+		for i := 0; i < 300; i++ {
+			k := rng.Intn(1000)
+			b.Set(k, 2)
+			ref[k] = 2
+		}
+		a.Merge(b)
+		checkSpans(t, a)
+		if a.Len() != len(ref) {
+			t.Fatalf("Expected: %v, Got: %v", len(ref), a.Len())
+		}
+		for k, v := range ref {
+			if got, _ := a.Get(k); got != v {
+				t.Fatalf("Get(%d): Expected: %v, Got: %v", k, v, got)
+			}
+		}
+	}
+}
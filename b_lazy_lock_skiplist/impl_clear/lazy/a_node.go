@@ -1,25 +1,58 @@
 package lazyskiplist
 
-import "sync"
-
-type Node struct {
-	key, value  interface{}
-	next        []*Node
-	prev        *Node
-	marked      bool
-	fullyLinked bool
+import (
+	"sync"
+	"sync/atomic"
+
+	"skiplist/internal/backoff"
+)
+
+// Node links, flags and value are written under the node locks but read
+// without them, so they are all atomics.
+type Node[K, V any] struct {
+	key         K
+	value       atomic.Pointer[V]
+	next        []atomic.Pointer[Node[K, V]]
+	prev        atomic.Pointer[Node[K, V]]
+	marked      atomic.Bool
+	fullyLinked atomic.Bool
 	lock        sync.Mutex
 }
 
-func newNode(key, value interface{}, level int) *Node {
-	return &Node{
-		key:         key,
-		value:       value,
-		next:        make([]*Node, level),
-		marked:      false,
-		fullyLinked: false}
+func newNode[K, V any](key K, value V, level int) *Node[K, V] {
+	node := &Node[K, V]{
+		key:  key,
+		next: make([]atomic.Pointer[Node[K, V]], level)}
+	node.storeValue(value)
+	return node
+}
+
+func (node *Node[K, V]) loadValue() (value V) {
+	if v := node.value.Load(); v != nil {
+		return *v
+	}
+	return value
+}
+
+func (node *Node[K, V]) storeValue(value V) {
+	node.value.Store(&value)
+}
+
+// isPresent reports whether node holds a key of the set: it is fully linked
+// and not marked.
+func (node *Node[K, V]) isPresent() bool {
+	return node.fullyLinked.Load() && !node.marked.Load()
 }
 
-func (node *Node) getLevel() int {
+func (node *Node[K, V]) getLevel() int {
 	return len(node.next)
 }
+
+// waitFullyLinked waits for the Put that is linking node to finish, which
+// takes no longer than the Put holding its locks.
+func (node *Node[K, V]) waitFullyLinked() {
+	var b backoff.Backoff
+	for !node.fullyLinked.Load() {
+		b.Wait()
+	}
+}
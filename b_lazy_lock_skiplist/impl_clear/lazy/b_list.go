@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math/rand"
 	"skiplist/b_lazy_lock_skiplist/impl_clear/lib"
+	"skiplist/epoch"
+	"sync"
 	"sync/atomic"
 )
 
@@ -12,66 +14,159 @@ var (
 	BRANCH    int = 4
 )
 
-type SkipList struct {
-	head       *Node
-	tail       *Node
-	comparator lib.Comparator
-	maxLevel   int
+// levelLimit is the number of levels up to which searches keep their
+// predecessors and successors on the stack. A list made while MAX_LEVEL was
+// set higher allocates them instead.
+const levelLimit = 32
+
+// path holds the predecessors or successors of a key at every level.
+type path[K, V any] []*Node[K, V]
+
+// newPath returns buf cut to the levels of the list, or a path of its own if
+// they do not fit.
+func (this *SkipList[K, V]) newPath(buf *[levelLimit]*Node[K, V]) path[K, V] {
+	levels := this.levelCount()
+	if levels <= levelLimit {
+		return buf[:levels]
+	}
+	return make(path[K, V], levels)
+}
+
+// levelCount returns the number of levels of the list, which is MAX_LEVEL as
+// of when the list was made.
+func (this *SkipList[K, V]) levelCount() int {
+	return len(this.head.next)
+}
+
+type SkipList[K, V any] struct {
+	head       *Node[K, V]
+	tail       *Node[K, V]
+	comparator lib.Comparator[K]
+	levels     LevelGenerator
 	size       int64
+	collector  *epoch.Collector // nil unless reclamation is enabled
+	nodes      []*epoch.Pool[Node[K, V]]
+	values     *epoch.Pool[V]
 }
 
-type OnUpdate func(old interface{}) interface{}
+// OnUpdate computes the value that replaces old when Put finds its key. It
+// runs under the node's lock, exactly once per such Put, so it must not call
+// back into the list.
+type OnUpdate[V any] func(old V) V
+
+// Option configures a SkipList at construction time.
+type Option func(*options)
+
+type options struct {
+	levels    LevelGenerator
+	collector *epoch.Collector
+}
 
-func NewLazySkipList(comparator lib.Comparator) *SkipList {
-	head := &Node{next: make([]*Node, MAX_LEVEL)}
-	tail := &Node{next: make([]*Node, MAX_LEVEL), prev: head}
+// LevelGenerator returns the level, in [1, MAX_LEVEL], of a node about to be
+// inserted. It is called concurrently by every Put.
+type LevelGenerator func() int
+
+// WithLevelGenerator makes the list take node levels from g, e.g. a seeded
+// NewLevelGenerator to make a run replayable, instead of the global math/rand
+// source.
+func WithLevelGenerator(g LevelGenerator) Option {
+	return func(o *options) { o.levels = g }
+}
+
+// NewLevelGenerator returns a LevelGenerator with the default 1 / BRANCH
+// distribution that draws from its own source seeded with seed. Calls are
+// serialized so that the sequence of levels only depends on the seed.
+func NewLevelGenerator(seed int64) LevelGenerator {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return branchLevel(rng.Intn)
+	}
+}
+
+func branchLevel(intn func(n int) int) int {
+	level := 1
+	for level < MAX_LEVEL && intn(BRANCH) == 0 {
+		level++
+	}
+	return level
+}
+
+func defaultLevel() int {
+	return branchLevel(rand.Intn)
+}
+
+// NewLazySkipList returns an empty list ordered by comparator, e.g.
+// lib.OrderedComparator[K] for any ordered key type.
+func NewLazySkipList[K, V any](comparator lib.Comparator[K], opts ...Option) *SkipList[K, V] {
+	o := options{levels: defaultLevel}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	head := &Node[K, V]{next: make([]atomic.Pointer[Node[K, V]], MAX_LEVEL)}
+	tail := &Node[K, V]{next: make([]atomic.Pointer[Node[K, V]], MAX_LEVEL)}
+	tail.prev.Store(head)
 	for i := range head.next {
-		head.next[i] = tail
+		head.next[i].Store(tail)
 	}
-	return &SkipList{
+	list := &SkipList[K, V]{
 		head:       head,
 		tail:       tail,
 		comparator: comparator,
-		maxLevel:   1}
+		levels:     o.levels,
+	}
+	if o.collector != nil {
+		list.enableReclamation(o.collector)
+	}
+	return list
 }
 
-func (this *SkipList) Size() int64 {
-	return this.size
+func (this *SkipList[K, V]) Size() int64 {
+	return atomic.LoadInt64(&this.size)
 }
 
 // Choose the new node's level, branching with p (1 / BRANCH) probability, with no regards to N (size of list)
-func (this *SkipList) randomLevel() int {
-	level := 1
-	for level < MAX_LEVEL && rand.Intn(BRANCH) == 0 {
-		level++
+func (this *SkipList[K, V]) randomLevel() int {
+	level := this.levels()
+	if level < 1 {
+		return 1
+	}
+	if levels := this.levelCount(); level > levels {
+		return levels
 	}
 	return level
 }
 
-func (this *SkipList) Get(key interface{}) (value interface{}, found bool) {
+func (this *SkipList[K, V]) Get(key K) (value V, found bool) {
+	defer unpin(this.pin())
 	pred := this.head
-	for lv := MAX_LEVEL - 1; lv >= 0; lv-- {
-		curr := pred.next[lv]
+	for lv := this.levelCount() - 1; lv >= 0; lv-- {
+		curr := pred.next[lv].Load()
 		for curr != this.tail && this.comparator(key, curr.key) > 0 {
 			pred = curr
-			curr = pred.next[lv]
+			curr = pred.next[lv].Load()
 		}
 
 		if curr != this.tail && this.comparator(key, curr.key) == 0 {
-			return curr.value, true
+			if !curr.isPresent() {
+				return value, false
+			}
+			return curr.loadValue(), true
 		}
 	}
-	return nil, false
+	return value, false
 }
 
-func (this *SkipList) findNode(key interface{}, preds []*Node, succs []*Node) int {
+func (this *SkipList[K, V]) findNode(key K, preds, succs path[K, V]) int {
 	lFound := -1
 	pred := this.head
-	for lv := MAX_LEVEL - 1; lv >= 0; lv-- {
-		curr := pred.next[lv]
+	for lv := this.levelCount() - 1; lv >= 0; lv-- {
+		curr := pred.next[lv].Load()
 		for curr != this.tail && this.comparator(key, curr.key) > 0 {
 			pred = curr
-			curr = pred.next[lv]
+			curr = pred.next[lv].Load()
 		}
 		if lFound == -1 && curr != this.tail && this.comparator(key, curr.key) == 0 {
 			lFound = lv
@@ -82,62 +177,86 @@ func (this *SkipList) findNode(key interface{}, preds []*Node, succs []*Node) in
 	return lFound
 }
 
-func (this *SkipList) tryPut(key, value interface{}, level int, preds []*Node, succs []*Node) bool {
+func (this *SkipList[K, V]) tryPut(key K, value V, level int, preds, succs path[K, V]) bool {
 	valid := true
-	var prevPred *Node
+	locked := 0
+	var prevPred *Node[K, V]
 	for lv := 0; valid && lv < level; lv++ {
 		pred := preds[lv]
 		succ := succs[lv]
 		if pred != prevPred {
 			pred.lock.Lock()
-			defer pred.lock.Unlock()
 			prevPred = pred
 		}
-		valid = !pred.marked && !succ.marked && pred.next[lv] == succ
+		locked = lv + 1
+		valid = !pred.marked.Load() && !succ.marked.Load() && pred.next[lv].Load() == succ
 	}
+	defer unlockPreds(preds, locked)
 	if !valid {
 		return false
 	}
 
-	node := newNode(key, value, level)
+	node := this.newNode(key, value, level)
 
-	node.prev = preds[0]
+	node.prev.Store(preds[0])
 
 	for lv := 0; lv < level; lv++ {
-		node.next[lv] = succs[lv]
-		preds[lv].next[lv] = node
+		node.next[lv].Store(succs[lv])
+		preds[lv].next[lv].Store(node)
 	}
 
-	succs[0].prev = node
+	succs[0].prev.Store(node)
 
-	node.fullyLinked = true
+	node.fullyLinked.Store(true)
 	return true
 }
 
-func (this *SkipList) Put(
-	key, value interface{},
-	onUpdate OnUpdate,
-) (old interface{}, newbie interface{}, replaced bool) {
+// unlockPreds unlocks the distinct predecessors locked by tryPut or tryRemove
+// in the lowest levels levels. A single deferred call, unlike a defer per lock,
+// does not allocate.
+func unlockPreds[K, V any](preds path[K, V], levels int) {
+	var prevPred *Node[K, V]
+	for lv := 0; lv < levels; lv++ {
+		if pred := preds[lv]; pred != prevPred {
+			pred.lock.Unlock()
+			prevPred = pred
+		}
+	}
+}
+
+func (this *SkipList[K, V]) Put(
+	key K, value V,
+	onUpdate OnUpdate[V],
+) (old V, newbie V, replaced bool) {
+	g := this.pin()
+	defer unpin(g)
 
 	level := this.randomLevel()
 
-	preds := make([]*Node, MAX_LEVEL)
-	succs := make([]*Node, MAX_LEVEL)
+	var predsBuf, succsBuf [levelLimit]*Node[K, V]
+	preds, succs := this.newPath(&predsBuf), this.newPath(&succsBuf)
 
 	for {
 		lFound := this.findNode(key, preds, succs)
 		if lFound != -1 {
 			nodeFound := succs[lFound]
-			if !nodeFound.marked {
-				for !nodeFound.fullyLinked {
+			if !nodeFound.marked.Load() {
+				nodeFound.waitFullyLinked()
+				// Remove marks under the same lock, so the update either
+				// happens before the removal or sees it and starts over.
+				nodeFound.lock.Lock()
+				if nodeFound.marked.Load() {
+					nodeFound.lock.Unlock()
+					continue
 				}
-				old = nodeFound.value
+				old = nodeFound.loadValue()
 				if onUpdate != nil {
 					newbie = onUpdate(old)
 				} else {
 					newbie = value
 				}
-				nodeFound.value = newbie
+				this.retireValue(g, nodeFound.value.Swap(this.newValue(newbie)))
+				nodeFound.lock.Unlock()
 				return old, newbie, true
 			}
 			continue
@@ -150,82 +269,89 @@ func (this *SkipList) Put(
 
 	atomic.AddInt64(&this.size, 1)
 
-	return nil, value, false
+	return old, value, false
 }
 
-func (this *SkipList) tryRemove(nodeToDelete *Node, preds []*Node, succs []*Node) bool {
+func (this *SkipList[K, V]) tryRemove(nodeToDelete *Node[K, V], preds, succs path[K, V]) bool {
 	valid := true
-	var prevPred *Node
+	locked := 0
+	var prevPred *Node[K, V]
 	level := nodeToDelete.getLevel()
 	for lv := 0; valid && lv < level; lv++ {
 		pred := preds[lv]
 		succ := succs[lv]
 		if pred != prevPred {
 			pred.lock.Lock()
-			defer pred.lock.Unlock()
 			prevPred = pred
 		}
-		valid = !pred.marked && pred.next[lv] == succ
+		locked = lv + 1
+		valid = !pred.marked.Load() && pred.next[lv].Load() == succ
 	}
+	defer unlockPreds(preds, locked)
 	if !valid {
 		return false
 	}
 
 	for lv := level - 1; lv >= 0; lv-- {
-		preds[lv].next[lv] = nodeToDelete.next[lv]
+		preds[lv].next[lv].Store(nodeToDelete.next[lv].Load())
 	}
-	nodeToDelete.next[0].prev = preds[0]
+	nodeToDelete.next[0].Load().prev.Store(preds[0])
 
 	return true
 }
 
-func (this *SkipList) Remove(key interface{}) (value interface{}, ok bool) {
-	var nodeToDelete *Node = nil
+func (this *SkipList[K, V]) Remove(key K) (value V, ok bool) {
+	g := this.pin()
+	defer unpin(g)
+
+	var nodeToDelete *Node[K, V] = nil
 	isMarked := false
-	preds := make([]*Node, MAX_LEVEL)
-	succs := make([]*Node, MAX_LEVEL)
+	var predsBuf, succsBuf [levelLimit]*Node[K, V]
+	preds, succs := this.newPath(&predsBuf), this.newPath(&succsBuf)
 	for {
 		lFound := this.findNode(key, preds, succs)
 		if isMarked || (lFound != -1 && okToDelete(succs[lFound], lFound)) {
 			if !isMarked {
 				nodeToDelete = succs[lFound]
 				nodeToDelete.lock.Lock()
-				if nodeToDelete.marked {
+				if nodeToDelete.marked.Load() {
 					// someone else will remove.
 					nodeToDelete.lock.Unlock()
-					return nil, false
+					return value, false
 				}
-				nodeToDelete.marked = true
+				nodeToDelete.marked.Store(true)
 				isMarked = true
 			}
 
+			// nodeToDelete stays locked until it is unlinked.
 			if this.tryRemove(nodeToDelete, preds, succs) {
 				nodeToDelete.lock.Unlock()
 				break
 			}
-			nodeToDelete.lock.Unlock()
 		} else {
-			return nil, false
+			return value, false
 		}
 	}
 	atomic.AddInt64(&this.size, -1)
-	return nodeToDelete.value, true
+	value = nodeToDelete.loadValue()
+	this.retire(g, nodeToDelete)
+	return value, true
 }
 
-func okToDelete(node *Node, lFound int) bool {
-	return node.fullyLinked && node.getLevel()-1 == lFound && !node.marked
+func okToDelete[K, V any](node *Node[K, V], lFound int) bool {
+	return node.fullyLinked.Load() && node.getLevel()-1 == lFound && !node.marked.Load()
 }
 
-func (this *SkipList) Print() {
+func (this *SkipList[K, V]) Print() {
 	fmt.Print("[h] ")
 	n := 0
-	for i := this.head.next[0]; n < 100 && i.next[0] != nil; i = i.next[0] {
+	for i := this.head.next[0].Load(); n < 100 && i.next[0].Load() != nil; i = i.next[0].Load() {
 		if cap(i.next) > 1 {
 			fmt.Printf("> [%v(%d)]", i.key, cap(i.next))
 		} else {
 			fmt.Printf("> [%v]", i.key)
 		}
-		if i.marked {
+		if i.marked.Load() {
 			fmt.Print("*")
 		}
 		fmt.Print(" ")
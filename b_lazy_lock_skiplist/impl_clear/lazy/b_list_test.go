@@ -1,13 +1,18 @@
 package lazyskiplist
 
 import (
+	"math"
+	"math/rand"
 	"reflect"
+	"runtime"
 	"skiplist/b_lazy_lock_skiplist/impl_clear/lib"
+	"skiplist/epoch"
+	"sync"
 	"testing"
 )
 
 func TestPut(t *testing.T) {
-	list := NewLazySkipList(lib.IntComparator)
+	list := NewLazySkipList[int, string](lib.IntComparator)
 	list.Put(1, "test", nil)
 	value, _ := list.Get(1)
 	if value != "test" {
@@ -15,17 +20,43 @@ func TestPut(t *testing.T) {
 	}
 }
 
+func TestOrderedKeys(t *testing.T) {
+	words := NewLazySkipList[string, int](lib.OrderedComparator[string])
+	for i, w := range []string{"pear", "apple", "fig"} {
+		words.Put(w, i, nil)
+	}
+	var slice []string
+	for it := words.First(); it.Present(); it.Next() {
+		slice = append(slice, it.Key())
+	}
+	if expected := []string{"apple", "fig", "pear"}; !reflect.DeepEqual(expected, slice) {
+		t.Errorf("Expected: %v, Got: %v", expected, slice)
+	}
+
+	// NaN sorts first and is found again, so floats are safe keys.
+	floats := NewLazySkipList[float64, bool](lib.Float64Comparator)
+	floats.Put(1, true, nil)
+	floats.Put(math.NaN(), true, nil)
+	floats.Put(-1, true, nil)
+	if _, found := floats.Get(math.NaN()); !found {
+		t.Errorf("Expected to find NaN")
+	}
+	if it := floats.First(); !math.IsNaN(it.Key()) {
+		t.Errorf("Expected: NaN, Got: %v", it.Key())
+	}
+}
+
 func TestIterator(t *testing.T) {
-	list := NewLazySkipList(lib.IntComparator)
+	list := NewLazySkipList[int, int](lib.IntComparator)
 
-	list.Put(1, nil, nil)
-	list.Put(3, nil, nil)
-	list.Put(5, nil, nil)
-	list.Put(7, nil, nil)
+	list.Put(1, 0, nil)
+	list.Put(3, 0, nil)
+	list.Put(5, 0, nil)
+	list.Put(7, 0, nil)
 
 	var slice []int
-	for it := list.Begin(nil); it.Present(); it.Next() {
-		slice = append(slice, it.Key().(int))
+	for it := list.Begin(math.MinInt); it.Present(); it.Next() {
+		slice = append(slice, it.Key())
 	}
 	expected := []int{1, 3, 5, 7}
 	if !reflect.DeepEqual(slice, expected) {
@@ -34,16 +65,16 @@ func TestIterator(t *testing.T) {
 }
 
 func TestReverseIterator(t *testing.T) {
-	list := NewLazySkipList(lib.IntComparator)
+	list := NewLazySkipList[int, int](lib.IntComparator)
 
-	list.Put(1, nil, nil)
-	list.Put(3, nil, nil)
-	list.Put(5, nil, nil)
-	list.Put(7, nil, nil)
+	list.Put(1, 0, nil)
+	list.Put(3, 0, nil)
+	list.Put(5, 0, nil)
+	list.Put(7, 0, nil)
 
 	var slice []int
-	for it := list.End(nil); it.Present(); it.Prev() {
-		slice = append(slice, it.Key().(int))
+	for it := list.End(math.MaxInt); it.Present(); it.Prev() {
+		slice = append(slice, it.Key())
 	}
 	expected := []int{7, 5, 3, 1}
 	if !reflect.DeepEqual(expected, slice) {
@@ -51,16 +82,40 @@ func TestReverseIterator(t *testing.T) {
 	}
 }
 
+func TestFirstAndLast(t *testing.T) {
+	list := NewLazySkipList[int, int](lib.IntComparator)
+	if list.First().Present() || list.Last().Present() {
+		t.Errorf("Expected First and Last of an empty list not to be Present")
+	}
+
+	list.Put(1, 0, nil)
+	list.Put(3, 0, nil)
+	list.Put(5, 0, nil)
+	list.Put(7, 0, nil)
+
+	var slice []int
+	for it := list.First(); it.Present(); it.Next() {
+		slice = append(slice, it.Key())
+	}
+	for it := list.Last(); it.Present(); it.Prev() {
+		slice = append(slice, it.Key())
+	}
+	expected := []int{1, 3, 5, 7, 7, 5, 3, 1}
+	if !reflect.DeepEqual(expected, slice) {
+		t.Errorf("Expected: %v, Got: %v", expected, slice)
+	}
+}
+
 func TestIteratorWithDeletedItem(t *testing.T) {
-	list := NewLazySkipList(lib.IntComparator)
+	list := NewLazySkipList[int, int](lib.IntComparator)
 
-	list.Put(1, nil, nil)
-	list.Put(3, nil, nil)
-	list.Put(5, nil, nil)
-	list.Put(7, nil, nil)
+	list.Put(1, 0, nil)
+	list.Put(3, 0, nil)
+	list.Put(5, 0, nil)
+	list.Put(7, 0, nil)
 
 	list.Print()
-	it := list.Begin(nil)
+	it := list.Begin(math.MinInt)
 
 	list.Remove(1)
 	list.Remove(5)
@@ -68,9 +123,9 @@ func TestIteratorWithDeletedItem(t *testing.T) {
 	var slice []int
 	var marked []int
 	for ; it.Present(); it.Next() {
-		slice = append(slice, it.Key().(int))
+		slice = append(slice, it.Key())
 		if it.IsMarked() {
-			marked = append(marked, it.Key().(int))
+			marked = append(marked, it.Key())
 		}
 	}
 	{
@@ -86,3 +141,466 @@ func TestIteratorWithDeletedItem(t *testing.T) {
 		}
 	}
 }
+
+func TestSeededLevels(t *testing.T) {
+	heights := func() []int {
+		list := NewLazySkipList[int, int](lib.IntComparator, WithLevelGenerator(NewLevelGenerator(3)))
+		for i := 0; i < 500; i++ {
+			list.Put(i, 0, nil)
+		}
+		var out []int
+		for node := list.head.next[0].Load(); node != list.tail; node = node.next[0].Load() {
+			out = append(out, node.getLevel())
+		}
+		return out
+	}
+	expected := heights()
+	if got := heights(); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+}
+
+func TestReclamation(t *testing.T) {
+	list := NewLazySkipList[int, int](lib.IntComparator, WithReclamation(epoch.NewCollector()))
+	for i := 0; i < 100; i += 2 {
+		list.Put(i, i, nil)
+	}
+
+	// An iterator parked on a removed node keeps it from being recycled.
+	it := list.Begin(math.MinInt)
+	list.Remove(0)
+
+	recycled := func() (n int) {
+		for _, pool := range list.nodes {
+			n += pool.Len()
+		}
+		return n
+	}
+	for round := 0; round < 50; round++ {
+		for i := 1; i < 100; i += 2 {
+			list.Put(i, i, nil)
+		}
+		for i := 1; i < 100; i += 2 {
+			list.Remove(i)
+		}
+	}
+	if n := recycled(); n != 0 {
+		t.Errorf("Expected nothing recycled while an iterator is open, Got: %v", n)
+	}
+	if it.Key() != 0 || !it.IsMarked() {
+		t.Errorf("Expected the iterator to still see removed key 0")
+	}
+	it.Close()
+
+	for round := 0; round < 50; round++ {
+		for i := 1; i < 100; i += 2 {
+			list.Put(i, i, nil)
+		}
+		for i := 1; i < 100; i += 2 {
+			list.Remove(i)
+		}
+	}
+	if recycled() == 0 {
+		t.Errorf("Expected removed nodes to be recycled")
+	}
+
+	var slice []int
+	for it := list.Begin(math.MinInt); it.Present(); it.Next() {
+		if it.Value() != it.Key() {
+			t.Errorf("Expected: %v, Got: %v", it.Key(), it.Value())
+		}
+		slice = append(slice, it.Key())
+	}
+	if len(slice) != 49 || slice[0] != 2 {
+		t.Errorf("Expected 2, 4, ..., 98, Got: %v", slice)
+	}
+}
+
+func TestReclamationAllocs(t *testing.T) {
+	list := NewLazySkipList[int, int](lib.IntComparator, WithReclamation(epoch.NewCollector()), WithLevelGenerator(NewLevelGenerator(1)))
+	for i := 0; i < 100; i += 2 {
+		list.Put(i, i, nil)
+	}
+	churn := func() {
+		for i := 1; i < 100; i += 2 {
+			list.Put(i, i, nil)
+		}
+		for i := 0; i < 100; i += 2 {
+			list.Put(i, i, nil)
+		}
+		for i := 1; i < 100; i += 2 {
+			list.Remove(i)
+		}
+	}
+	// Warm up the free lists.
+	for round := 0; round < 20; round++ {
+		churn()
+	}
+
+	// Each churn is 150 operations; without reclamation every Put allocates
+	// at least a value box, and every insert a node too.
+	if allocs := testing.AllocsPerRun(100, churn); allocs > 10 {
+		t.Errorf("Expected: <= 10 allocations per 150 operations, Got: %v", allocs)
+	}
+	if list.Size() != 50 {
+		t.Errorf("Expected: %v, Got: %v", 50, list.Size())
+	}
+}
+
+// TestReclamationStress updates and removes a small key space from many
+// goroutines while others read. A value box recycled too early would show up
+// as a value that does not belong to its key, or as a race.
+func TestReclamationStress(t *testing.T) {
+	const (
+		goroutines = 8
+		iterations = 5000
+		keys       = 64
+	)
+	list := NewLazySkipList[int, int](lib.IntComparator, WithReclamation(epoch.NewCollector()))
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < iterations; i++ {
+				key := rng.Intn(keys)
+				switch rng.Intn(4) {
+				case 0:
+					list.Put(key, -key, nil)
+				case 1:
+					list.Remove(key)
+				case 2:
+					if v, ok := list.Get(key); ok && v != -key {
+						t.Errorf("Get(%d) = %d", key, v)
+					}
+				default:
+					for k, v := range list.All() {
+						if v != -k {
+							t.Errorf("All saw %d:%d", k, v)
+						}
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// TestRemoveWhileInserting races removers against a goroutine that keeps
+// re-adding the same keys, with GOMAXPROCS=1 and with the default. Run it
+// with -race.
+func TestRemoveWhileInserting(t *testing.T) {
+	for _, procs := range []int{1, runtime.GOMAXPROCS(0)} {
+		prev := runtime.GOMAXPROCS(procs)
+		const (
+			removers   = 4
+			iterations = 2000
+			keys       = 16
+		)
+		list := NewLazySkipList[int, int](lib.IntComparator)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Only this goroutine adds, so a key it sees missing stays
+			// missing until it puts it back.
+			for i := 0; i < iterations; i++ {
+				if _, found := list.Get(i % keys); !found {
+					list.Put(i%keys, i%keys, nil)
+				}
+			}
+		}()
+		for r := 0; r < removers; r++ {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					if value, ok := list.Remove((i + r) % keys); ok && value != (i+r)%keys {
+						t.Errorf("Expected: %v, Got: %v", (i+r)%keys, value)
+					}
+				}
+			}(r)
+		}
+		wg.Wait()
+		runtime.GOMAXPROCS(prev)
+
+		var n int64
+		last := -1
+		for it := list.Begin(math.MinInt); it.Present(); it.Next() {
+			if it.IsMarked() || it.Key() <= last {
+				t.Fatalf("GOMAXPROCS=%d: unexpected key %v after %d", procs, it.Key(), last)
+			}
+			last = it.Key()
+			n++
+		}
+		if n != list.Size() {
+			t.Errorf("Expected: %v, Got: %v", list.Size(), n)
+		}
+	}
+}
+
+// TestConcurrentCounter uses Put with OnUpdate as a counter map from many
+// goroutines, which covers concurrent duplicate inserts, while others read
+// and remove unrelated keys. No increment may be lost. Run it with -race.
+func TestConcurrentCounter(t *testing.T) {
+	for _, procs := range []int{1, runtime.GOMAXPROCS(0)} {
+		prev := runtime.GOMAXPROCS(procs)
+		const (
+			goroutines = 8
+			iterations = 1000
+			keys       = 4
+		)
+		list := NewLazySkipList[int, int](lib.IntComparator)
+		incr := func(old int) int { return old + 1 }
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					list.Put((g+i)%keys, 1, incr)
+					if v, found := list.Get((g + i + 1) % keys); found && v < 1 {
+						t.Errorf("Expected a positive count, Got: %v", v)
+					}
+				}
+			}(g)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				list.Put(keys+i%8, i, nil)
+				list.Remove(keys + (i+4)%8)
+			}
+		}()
+		wg.Wait()
+		runtime.GOMAXPROCS(prev)
+
+		total := 0
+		for key := 0; key < keys; key++ {
+			v, _ := list.Get(key)
+			total += v
+		}
+		if total != goroutines*iterations {
+			t.Errorf("GOMAXPROCS=%d: Expected: %v, Got: %v", procs, goroutines*iterations, total)
+		}
+	}
+}
+
+func TestBounds(t *testing.T) {
+	list := NewLazySkipList[int, int](lib.IntComparator)
+	for _, k := range []int{10, 20, 30} {
+		list.Put(k, k, nil)
+	}
+
+	type bound func(int) (int, int, bool)
+	for _, tc := range []struct {
+		name  string
+		fn    bound
+		query int
+		key   int
+		found bool
+	}{
+		{"Ceiling", list.Ceiling, 5, 10, true},
+		{"Ceiling", list.Ceiling, 20, 20, true},
+		{"Ceiling", list.Ceiling, 25, 30, true},
+		{"Ceiling", list.Ceiling, 35, 0, false},
+		{"Higher", list.Higher, 20, 30, true},
+		{"Higher", list.Higher, 30, 0, false},
+		{"Floor", list.Floor, 5, 0, false},
+		{"Floor", list.Floor, 20, 20, true},
+		{"Floor", list.Floor, 25, 20, true},
+		{"Floor", list.Floor, 35, 30, true},
+		{"Lower", list.Lower, 20, 10, true},
+		{"Lower", list.Lower, 10, 0, false},
+	} {
+		key, value, found := tc.fn(tc.query)
+		if found != tc.found || key != tc.key || value != tc.key {
+			t.Errorf("%s(%d): Expected: %v %v, Got: %v %v", tc.name, tc.query, tc.key, tc.found, key, found)
+		}
+	}
+
+	if it := list.Begin(35); it.Present() {
+		t.Errorf("Expected Begin past the last key not to be Present")
+	}
+	if it := list.End(5); it.Present() {
+		t.Errorf("Expected End before the first key not to be Present")
+	}
+	if it := list.End(25); !it.Present() || it.Key() != 20 {
+		t.Errorf("Expected End(25) on 20")
+	}
+}
+
+func TestBoundsSkipAbsentNodes(t *testing.T) {
+	list := NewLazySkipList[int, int](lib.IntComparator)
+	for _, k := range []int{10, 20, 30, 40} {
+		list.Put(k, k, nil)
+	}
+	// Pretend 20 is being removed and 30 is still being added.
+	node20 := list.head.next[0].Load().next[0].Load()
+	node30 := node20.next[0].Load()
+	node20.marked.Store(true)
+	node30.fullyLinked.Store(false)
+
+	if key, _, _ := list.Ceiling(15); key != 40 {
+		t.Errorf("Expected: %v, Got: %v", 40, key)
+	}
+	if key, _, _ := list.Floor(35); key != 10 {
+		t.Errorf("Expected: %v, Got: %v", 10, key)
+	}
+	if key, _, _ := list.Lower(40); key != 10 {
+		t.Errorf("Expected: %v, Got: %v", 10, key)
+	}
+	if _, found := list.Get(20); found {
+		t.Errorf("Expected a marked node not to be found")
+	}
+	if it := list.Begin(20); it.Key() != 40 {
+		t.Errorf("Expected: %v, Got: %v", 40, it.Key())
+	}
+}
+
+func rangeKeys(it *RangeIterator[int, int]) []int {
+	defer it.Close()
+	keys := []int{}
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+func TestRange(t *testing.T) {
+	list := NewLazySkipList[int, int](lib.IntComparator)
+	for _, k := range []int{10, 20, 30, 40, 50} {
+		list.Put(k, k, nil)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		lo, hi Bound[int]
+		opts   RangeOptions
+		keys   []int
+	}{
+		{"inclusive", Inclusive(20), Inclusive(40), RangeOptions{}, []int{20, 30, 40}},
+		{"exclusive", Exclusive(20), Exclusive(40), RangeOptions{}, []int{30}},
+		{"between keys", Inclusive(15), Exclusive(45), RangeOptions{}, []int{20, 30, 40}},
+		{"unbounded", Unbounded[int](), Unbounded[int](), RangeOptions{}, []int{10, 20, 30, 40, 50}},
+		{"empty", Exclusive(20), Exclusive(30), RangeOptions{}, []int{}},
+		{"reverse", Exclusive(10), Inclusive(40), RangeOptions{Reverse: true}, []int{40, 30, 20}},
+		{"reverse unbounded", Unbounded[int](), Unbounded[int](), RangeOptions{Reverse: true}, []int{50, 40, 30, 20, 10}},
+		{"limit", Inclusive(20), Unbounded[int](), RangeOptions{Limit: 2}, []int{20, 30}},
+		{"reverse limit", Unbounded[int](), Exclusive(50), RangeOptions{Reverse: true, Limit: 2}, []int{40, 30}},
+	} {
+		if keys := rangeKeys(list.Range(tc.lo, tc.hi, tc.opts)); !reflect.DeepEqual(keys, tc.keys) {
+			t.Errorf("%s: Expected: %v, Got: %v", tc.name, tc.keys, keys)
+		}
+	}
+
+	// Pretend 30 is being removed.
+	list.head.next[0].Load().next[0].Load().next[0].Load().marked.Store(true)
+	if keys := rangeKeys(list.Range(Inclusive(20), Inclusive(40), RangeOptions{})); !reflect.DeepEqual(keys, []int{20, 30, 40}) {
+		t.Errorf("Expected: %v, Got: %v", []int{20, 30, 40}, keys)
+	}
+	opts := RangeOptions{SkipMarked: true}
+	if keys := rangeKeys(list.Range(Inclusive(20), Inclusive(40), opts)); !reflect.DeepEqual(keys, []int{20, 40}) {
+		t.Errorf("Expected: %v, Got: %v", []int{20, 40}, keys)
+	}
+	opts.Reverse = true
+	if keys := rangeKeys(list.Range(Inclusive(30), Inclusive(30), opts)); len(keys) != 0 {
+		t.Errorf("Expected no keys, Got: %v", keys)
+	}
+}
+
+func TestRangeFunc(t *testing.T) {
+	collector := epoch.NewCollector()
+	list := NewLazySkipList[int, int](lib.IntComparator, WithReclamation(collector))
+	for _, k := range []int{10, 20, 30, 40, 50} {
+		list.Put(k, k*2, nil)
+	}
+
+	keys := []int{}
+	for k, v := range list.All() {
+		if v != k*2 {
+			t.Errorf("Expected: %v, Got: %v", k*2, v)
+		}
+		keys = append(keys, k)
+	}
+	if !reflect.DeepEqual(keys, []int{10, 20, 30, 40, 50}) {
+		t.Errorf("Expected: %v, Got: %v", []int{10, 20, 30, 40, 50}, keys)
+	}
+
+	keys = keys[:0]
+	for k := range list.Backward() {
+		if k == 30 {
+			break
+		}
+		keys = append(keys, k)
+	}
+	if !reflect.DeepEqual(keys, []int{50, 40}) {
+		t.Errorf("Expected: %v, Got: %v", []int{50, 40}, keys)
+	}
+
+	keys = keys[:0]
+	for k := range list.Range(Exclusive(10), Inclusive(40), RangeOptions{Limit: 2}).All() {
+		keys = append(keys, k)
+	}
+	if !reflect.DeepEqual(keys, []int{20, 30}) {
+		t.Errorf("Expected: %v, Got: %v", []int{20, 30}, keys)
+	}
+
+	keys = keys[:0]
+	for k := range list.RangeSeq(20, 50) {
+		keys = append(keys, k)
+	}
+	if !reflect.DeepEqual(keys, []int{20, 30, 40}) {
+		t.Errorf("Expected: %v, Got: %v", []int{20, 30, 40}, keys)
+	}
+
+	// Breaking out of the loops closed their iterators, and a sequence that
+	// is never ranged over pins nothing, so a removed node is recycled once
+	// the epoch moves on.
+	unused := list.RangeSeq(0, 100)
+	list.Remove(20)
+	for i := 0; i < 256; i++ {
+		list.Put(100+i, i, nil)
+		list.Remove(100 + i)
+	}
+	recycled := 0
+	for _, pool := range list.nodes {
+		recycled += pool.Len()
+	}
+	if recycled == 0 {
+		t.Errorf("Expected removed nodes to be recycled")
+	}
+	for k := range unused {
+		if k == 20 {
+			t.Errorf("Expected 20 to be removed")
+		}
+	}
+}
+
+// TestMaxLevelAboveLevelLimit tests a list made with more levels than
+// searches keep on the stack.
+func TestMaxLevelAboveLevelLimit(t *testing.T) {
+	defer func(maxLevel int) { MAX_LEVEL = maxLevel }(MAX_LEVEL)
+	MAX_LEVEL = levelLimit + 8
+	list := NewLazySkipList[int, int](lib.IntComparator, WithLevelGenerator(func() int { return levelLimit + 8 }))
+	MAX_LEVEL = 4
+
+	for i := 0; i < 10; i++ {
+		list.Put(i, i, nil)
+	}
+	list.Remove(5)
+	if _, found := list.Get(5); found {
+		t.Errorf("Expected 5 to be removed")
+	}
+	if value, found := list.Get(9); !found || value != 9 {
+		t.Errorf("Expected: %v, Got: %v", 9, value)
+	}
+	if list.Size() != 9 {
+		t.Errorf("Expected: %v, Got: %v", 9, list.Size())
+	}
+}
@@ -1,42 +1,72 @@
 package lazyskiplist
 
-type Iterator struct {
-	list *SkipList
-	node *Node
+import "skiplist/epoch"
+
+type Iterator[K, V any] struct {
+	list  *SkipList[K, V]
+	node  *Node[K, V]
+	guard *epoch.Guard // pinned while the list reclaims nodes
 }
 
-func (it *Iterator) Next() bool {
-	if finger := it.node.next[0]; finger != nil {
+func (it *Iterator[K, V]) Next() bool {
+	if finger := it.node.next[0].Load(); finger != nil {
 		it.node = finger
 		return true
 	}
 	return false
 }
 
-func (it *Iterator) Prev() bool {
-	if finger := it.node.prev; finger != nil {
+func (it *Iterator[K, V]) Prev() bool {
+	if finger := it.node.prev.Load(); finger != nil {
 		it.node = finger
 		return true
 	}
 	return false
 }
 
-func (it *Iterator) Present() bool {
+func (it *Iterator[K, V]) Present() bool {
 	return it.node != it.list.head && it.node != it.list.tail
 }
 
-func (it *Iterator) IsMarked() bool {
-	return it.node.marked
+func (it *Iterator[K, V]) IsMarked() bool {
+	return it.node.marked.Load()
+}
+
+// IsFullyLinked reports whether the node is linked at all of its levels. A
+// node that is still being added is not.
+func (it *Iterator[K, V]) IsFullyLinked() bool {
+	return it.node.fullyLinked.Load()
 }
 
-func (it *Iterator) CompareTo(key interface{}) int {
+func (it *Iterator[K, V]) CompareTo(key K) int {
 	return it.list.comparator(it.node.key, key)
 }
 
-func (it *Iterator) Key() interface{} {
+func (it *Iterator[K, V]) Key() K {
 	return it.node.key
 }
 
-func (it *Iterator) Value() interface{} {
-	return it.node.value
+func (it *Iterator[K, V]) Value() V {
+	return it.node.loadValue()
+}
+
+// Seek moves the iterator to the first present node whose key is >= key,
+// searching from the top level down, and reports whether that node's key
+// equals key.
+func (it *Iterator[K, V]) Seek(key K) bool {
+	it.pin()
+	it.node = it.list.seekGE(key, false)
+	return it.Present() && it.list.comparator(it.node.key, key) == 0
+}
+
+// SeekToFirst moves the iterator to the first node.
+func (it *Iterator[K, V]) SeekToFirst() {
+	it.pin()
+	it.node = it.list.head.next[0].Load()
+}
+
+func (it *Iterator[K, V]) pin() {
+	if it.guard == nil {
+		it.guard = it.list.pin()
+	}
 }
@@ -1,67 +1,108 @@
 package lazyskiplist
 
-func (this *SkipList) findCeiling(query interface{}) (node *Node) {
-	if query == nil {
-		return nil
-	}
+// The searches below only return nodes that are present: fully linked and
+// not marked, as in Contains of the lazy list algorithm. A node that is still
+// being added or is being removed is passed over as if it were absent.
+
+// seekGE returns the first present node with a key >= query, or > query if
+// strict, or the tail if there is none.
+func (this *SkipList[K, V]) seekGE(query K, strict bool) *Node[K, V] {
 	pred := this.head
-	for lv := MAX_LEVEL - 1; lv >= 0; lv-- {
-		curr := pred.next[lv]
-		for curr != this.tail && this.comparator(query, curr.key) > 0 {
+	for lv := this.levelCount() - 1; lv >= 0; lv-- {
+		curr := pred.next[lv].Load()
+		for curr != this.tail && this.before(curr, query, strict) {
 			pred = curr
-			curr = pred.next[lv]
-		}
-
-		if curr != this.tail && this.comparator(query, curr.key) == 0 {
-			return curr
+			curr = pred.next[lv].Load()
 		}
 	}
-	return pred.next[0]
+	// A removed node keeps its links, so walking on from it is safe.
+	node := pred.next[0].Load()
+	for node != this.tail && !node.isPresent() {
+		node = node.next[0].Load()
+	}
+	return node
 }
 
-func (this *SkipList) findFloor(query interface{}) (node *Node) {
-	if query == nil {
-		return nil
-	}
-	pred := this.head
-	for lv := MAX_LEVEL - 1; lv >= 0; lv-- {
-		curr := pred.next[lv]
-		for curr != this.tail && this.comparator(query, curr.key) > 0 {
-			pred = curr
-			curr = pred.next[lv]
+// seekLE returns the last present node with a key <= query, or < query if
+// strict, or the head if there is none.
+func (this *SkipList[K, V]) seekLE(query K, strict bool) *Node[K, V] {
+	for {
+		pred := this.head
+		for lv := this.levelCount() - 1; lv >= 0; lv-- {
+			curr := pred.next[lv].Load()
+			for curr != this.tail && this.before(curr, query, !strict) {
+				pred = curr
+				curr = pred.next[lv].Load()
+			}
 		}
-
-		if curr != this.tail && this.comparator(query, curr.key) == 0 {
-			return curr
+		if pred == this.head || pred.isPresent() {
+			return pred
 		}
+		// Levels only link forward, so look again below the absent node.
+		query, strict = pred.key, true
 	}
-	return pred
 }
 
-func (this *SkipList) Ceiling(query interface{}) (key, value interface{}, found bool) {
-	if node := this.findCeiling(query); node != nil {
-		return node.key, node.value, true
-	}
-	return nil, nil, false
+// before reports whether node's key is < query, or <= query if orEqual.
+func (this *SkipList[K, V]) before(node *Node[K, V], query K, orEqual bool) bool {
+	c := this.comparator(node.key, query)
+	return c < 0 || orEqual && c == 0
 }
 
-func (this *SkipList) Floor(query interface{}) (key, value interface{}, found bool) {
-	if node := this.findFloor(query); node != nil {
-		return node.key, node.value, true
-	}
-	return nil, nil, false
+// Ceiling returns the least key >= query.
+func (this *SkipList[K, V]) Ceiling(query K) (key K, value V, found bool) {
+	defer unpin(this.pin())
+	return this.entry(this.seekGE(query, false))
 }
 
-func (list *SkipList) Begin(query interface{}) *Iterator {
-	if node := list.findCeiling(query); node != nil {
-		return &Iterator{list: list, node: node}
-	}
-	return &Iterator{list: list, node: list.head.next[0]}
+// Higher returns the least key > query.
+func (this *SkipList[K, V]) Higher(query K) (key K, value V, found bool) {
+	defer unpin(this.pin())
+	return this.entry(this.seekGE(query, true))
 }
 
-func (list *SkipList) End(query interface{}) *Iterator {
-	if node := list.findFloor(query); node != nil {
-		return &Iterator{list: list, node: node}
+// Floor returns the greatest key <= query.
+func (this *SkipList[K, V]) Floor(query K) (key K, value V, found bool) {
+	defer unpin(this.pin())
+	return this.entry(this.seekLE(query, false))
+}
+
+// Lower returns the greatest key < query.
+func (this *SkipList[K, V]) Lower(query K) (key K, value V, found bool) {
+	defer unpin(this.pin())
+	return this.entry(this.seekLE(query, true))
+}
+
+// entry returns the key and value of node, or found = false for a sentinel.
+func (this *SkipList[K, V]) entry(node *Node[K, V]) (key K, value V, found bool) {
+	if node == this.head || node == this.tail {
+		return key, value, false
 	}
-	return &Iterator{list: list, node: list.tail.prev}
+	return node.key, node.loadValue(), true
+}
+
+// Begin returns an iterator on the Ceiling of query. It is not Present if
+// there is none.
+func (list *SkipList[K, V]) Begin(query K) *Iterator[K, V] {
+	guard := list.pin()
+	return &Iterator[K, V]{list: list, node: list.seekGE(query, false), guard: guard}
+}
+
+// End returns an iterator on the Floor of query. It is not Present if there
+// is none.
+func (list *SkipList[K, V]) End(query K) *Iterator[K, V] {
+	guard := list.pin()
+	return &Iterator[K, V]{list: list, node: list.seekLE(query, false), guard: guard}
+}
+
+// First returns an iterator on the first node.
+func (list *SkipList[K, V]) First() *Iterator[K, V] {
+	guard := list.pin()
+	return &Iterator[K, V]{list: list, node: list.head.next[0].Load(), guard: guard}
+}
+
+// Last returns an iterator on the last node.
+func (list *SkipList[K, V]) Last() *Iterator[K, V] {
+	guard := list.pin()
+	return &Iterator[K, V]{list: list, node: list.tail.prev.Load(), guard: guard}
 }
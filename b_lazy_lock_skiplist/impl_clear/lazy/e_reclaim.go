@@ -0,0 +1,100 @@
+package lazyskiplist
+
+import (
+	"skiplist/epoch"
+)
+
+// WithReclamation makes the list recycle removed nodes through free lists
+// guarded by collector instead of leaving them to the garbage collector.
+// Every operation pins a guard of collector while it runs, and iterators stay
+// pinned until they are closed.
+func WithReclamation(collector *epoch.Collector) Option {
+	return func(o *options) { o.collector = collector }
+}
+
+func (this *SkipList[K, V]) enableReclamation(collector *epoch.Collector) {
+	this.collector = collector
+	this.values = epoch.NewPool(func(value *V) {
+		var zero V
+		*value = zero
+	})
+	// Nodes are pooled by level so that their next slices can be reused.
+	this.nodes = make([]*epoch.Pool[Node[K, V]], this.levelCount())
+	for i := range this.nodes {
+		this.nodes[i] = epoch.NewPool(func(node *Node[K, V]) {
+			for lv := range node.next {
+				node.next[lv].Store(nil)
+			}
+			var zero K
+			node.key = zero
+			// Its value goes out of use with it.
+			if value := node.value.Swap(nil); value != nil {
+				this.values.Put(value)
+			}
+			node.prev.Store(nil)
+			node.marked.Store(false)
+			node.fullyLinked.Store(false)
+		})
+	}
+}
+
+// pin returns a pinned guard, or nil if reclamation is disabled.
+func (this *SkipList[K, V]) pin() *epoch.Guard {
+	if this.collector == nil {
+		return nil
+	}
+	return this.collector.Pin()
+}
+
+func unpin(g *epoch.Guard) {
+	if g != nil {
+		g.Unpin()
+	}
+}
+
+func (this *SkipList[K, V]) newNode(key K, value V, level int) *Node[K, V] {
+	if this.collector != nil {
+		if node := this.nodes[level-1].Get(); node != nil {
+			node.key = key
+			node.value.Store(this.newValue(value))
+			return node
+		}
+	}
+	return newNode(key, value, level)
+}
+
+// newValue returns a box holding value.
+func (this *SkipList[K, V]) newValue(value V) *V {
+	if this.collector != nil {
+		if box := this.values.Get(); box != nil {
+			*box = value
+			return box
+		}
+	}
+	box := new(V)
+	*box = value
+	return box
+}
+
+// retireValue recycles a value box that was swapped out once no pinned
+// goroutine can still read it.
+func (this *SkipList[K, V]) retireValue(g *epoch.Guard, value *V) {
+	if g != nil {
+		g.Retire(value, this.values)
+	}
+}
+
+// retire recycles a node once it is unlinked at every level and no pinned
+// goroutine can still reach it.
+func (this *SkipList[K, V]) retire(g *epoch.Guard, node *Node[K, V]) {
+	if g != nil {
+		g.Retire(node, this.nodes[node.getLevel()-1])
+	}
+}
+
+// Close releases the guard the iterator holds when reclamation is enabled.
+// The iterator must not be used afterwards.
+func (it *Iterator[K, V]) Close() {
+	unpin(it.guard)
+	it.guard = nil
+}
@@ -0,0 +1,164 @@
+package lazyskiplist
+
+import (
+	"iter"
+	"skiplist/epoch"
+)
+
+// Bound is one end of a key range passed to Range.
+type Bound[K any] struct {
+	key       K
+	inclusive bool
+	unbounded bool
+}
+
+// Inclusive returns a bound that includes key.
+func Inclusive[K any](key K) Bound[K] { return Bound[K]{key: key, inclusive: true} }
+
+// Exclusive returns a bound that excludes key.
+func Exclusive[K any](key K) Bound[K] { return Bound[K]{key: key} }
+
+// Unbounded returns a bound that does not limit the range.
+func Unbounded[K any]() Bound[K] { return Bound[K]{unbounded: true} }
+
+// RangeOptions tunes the iterator returned by Range. The zero value walks the
+// whole range in ascending order and, like Iterator, shows marked nodes.
+type RangeOptions struct {
+	// Reverse walks from the upper bound down to the lower one.
+	Reverse bool
+	// Limit stops the iterator after that many nodes; 0 means no limit.
+	Limit int
+	// SkipMarked passes over nodes that are being added or removed.
+	SkipMarked bool
+}
+
+// RangeIterator walks the keys between two bounds. It is weakly consistent in
+// the same way as Iterator.
+type RangeIterator[K, V any] struct {
+	list   *SkipList[K, V]
+	node   *Node[K, V]
+	lo, hi Bound[K]
+	opts   RangeOptions
+	seen   int
+	guard  *epoch.Guard
+}
+
+// Range returns an iterator over the keys from lo up to hi, positioned on
+// the first of them, or the last one if opts.Reverse is set. The iterator
+// only ever starts on a present node.
+func (this *SkipList[K, V]) Range(lo, hi Bound[K], opts RangeOptions) *RangeIterator[K, V] {
+	it := &RangeIterator[K, V]{list: this, lo: lo, hi: hi, opts: opts, guard: this.pin()}
+	switch {
+	case opts.Reverse && hi.unbounded:
+		it.node = this.tail
+		it.step(true)
+	case opts.Reverse:
+		it.node = this.seekLE(hi.key, !hi.inclusive)
+	case lo.unbounded:
+		it.node = this.head
+		it.step(true)
+	default:
+		it.node = this.seekGE(lo.key, !lo.inclusive)
+	}
+	return it
+}
+
+// All returns an iterator over the present keys in ascending order, for use
+// with range-over-func loops. It is weakly consistent in the same way as
+// Iterator.
+func (this *SkipList[K, V]) All() iter.Seq2[K, V] {
+	return this.seq(Unbounded[K](), Unbounded[K](), RangeOptions{SkipMarked: true})
+}
+
+// Backward is All in descending order.
+func (this *SkipList[K, V]) Backward() iter.Seq2[K, V] {
+	return this.seq(Unbounded[K](), Unbounded[K](), RangeOptions{Reverse: true, SkipMarked: true})
+}
+
+// RangeSeq is All restricted to the keys in [lo, hi). It is named as in the
+// other lists, since Range is the bounded iterator here. Unlike Range, it
+// pins nothing until the loop starts.
+func (this *SkipList[K, V]) RangeSeq(lo, hi K) iter.Seq2[K, V] {
+	return this.seq(Inclusive(lo), Exclusive(hi), RangeOptions{SkipMarked: true})
+}
+
+// seq defers the call to Range until the loop starts, so that a sequence that
+// is never ranged over holds no guard.
+func (this *SkipList[K, V]) seq(lo, hi Bound[K], opts RangeOptions) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		this.Range(lo, hi, opts).All()(yield)
+	}
+}
+
+// All returns the rest of the walk of the iterator for use with
+// range-over-func loops, as in
+//
+//	for k, v := range list.Range(lo, hi, opts).All() {
+//
+// The iterator is closed when the loop ends, including on break.
+func (it *RangeIterator[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// Valid returns true iff the iterator is positioned on a node in the range
+// and the limit is not reached.
+func (it *RangeIterator[K, V]) Valid() bool {
+	node, list := it.node, it.list
+	if node == list.head || node == list.tail {
+		return false
+	}
+	if it.opts.Limit > 0 && it.seen >= it.opts.Limit {
+		return false
+	}
+	if it.opts.Reverse {
+		return it.lo.unbounded || !list.before(node, it.lo.key, !it.lo.inclusive)
+	}
+	return it.hi.unbounded || list.before(node, it.hi.key, it.hi.inclusive)
+}
+
+// Next moves the iterator one node on, towards hi, or towards lo in reverse.
+func (it *RangeIterator[K, V]) Next() {
+	it.seen++
+	it.step(it.opts.SkipMarked)
+}
+
+// step moves one node on, then on past absent nodes if skipAbsent is set.
+func (it *RangeIterator[K, V]) step(skipAbsent bool) {
+	for {
+		if it.opts.Reverse {
+			it.node = it.node.prev.Load()
+		} else {
+			it.node = it.node.next[0].Load()
+		}
+		if it.node == it.list.head || it.node == it.list.tail ||
+			!skipAbsent || it.node.isPresent() {
+			return
+		}
+	}
+}
+
+func (it *RangeIterator[K, V]) Key() K {
+	return it.node.key
+}
+
+func (it *RangeIterator[K, V]) Value() V {
+	return it.node.loadValue()
+}
+
+func (it *RangeIterator[K, V]) IsMarked() bool {
+	return it.node.marked.Load()
+}
+
+// Close releases the guard the iterator holds when reclamation is enabled.
+// The iterator must not be used afterwards.
+func (it *RangeIterator[K, V]) Close() {
+	unpin(it.guard)
+	it.guard = nil
+}
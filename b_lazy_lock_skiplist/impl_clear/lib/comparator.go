@@ -2,245 +2,91 @@ package lib
 
 import "time"
 
-// Comparator will make type assertion (see IntComparator for example),
-// which will panic if a or b are not of the asserted type.
+// Comparator orders keys of type K.
 //
 // Should return a number:
 //
 //	negative , if a < b
 //	zero     , if a == b
 //	positive , if a > b
-type Comparator func(a, b interface{}) int
-
-// StringComparator provides a fast comparison on strings
-func StringComparator(a, b interface{}) int {
-	s1 := a.(string)
-	s2 := b.(string)
-	min := len(s2)
-	if len(s1) < len(s2) {
-		min = len(s1)
-	}
-	diff := 0
-	for i := 0; i < min && diff == 0; i++ {
-		diff = int(s1[i]) - int(s2[i])
-	}
-	if diff == 0 {
-		diff = len(s1) - len(s2)
-	}
-	if diff < 0 {
-		return -1
-	}
-	if diff > 0 {
-		return 1
-	}
-	return 0
+type Comparator[K any] func(a, b K) int
+
+// Ordered is the set of types that support the < operator, like cmp.Ordered.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 |
+		~string
 }
 
-// IntComparator provides a basic comparison on int
-func IntComparator(a, b interface{}) int {
-	aAsserted := a.(int)
-	bAsserted := b.(int)
+// OrderedComparator compares any Ordered type with < and ==, like
+// cmp.Compare. A NaN is less than any other float and equal to any NaN, so
+// floats are totally ordered.
+func OrderedComparator[K Ordered](a, b K) int {
+	aNaN, bNaN := a != a, b != b
 	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
+	case aNaN && bNaN:
+		return 0
+	case aNaN || a < b:
 		return -1
+	case bNaN || a > b:
+		return 1
 	default:
 		return 0
 	}
 }
 
+// StringComparator compares strings byte-wise
+func StringComparator(a, b string) int { return OrderedComparator(a, b) }
+
+// IntComparator provides a basic comparison on int
+func IntComparator(a, b int) int { return OrderedComparator(a, b) }
+
 // Int8Comparator provides a basic comparison on int8
-func Int8Comparator(a, b interface{}) int {
-	aAsserted := a.(int8)
-	bAsserted := b.(int8)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func Int8Comparator(a, b int8) int { return OrderedComparator(a, b) }
 
 // Int16Comparator provides a basic comparison on int16
-func Int16Comparator(a, b interface{}) int {
-	aAsserted := a.(int16)
-	bAsserted := b.(int16)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func Int16Comparator(a, b int16) int { return OrderedComparator(a, b) }
 
 // Int32Comparator provides a basic comparison on int32
-func Int32Comparator(a, b interface{}) int {
-	aAsserted := a.(int32)
-	bAsserted := b.(int32)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func Int32Comparator(a, b int32) int { return OrderedComparator(a, b) }
 
 // Int64Comparator provides a basic comparison on int64
-func Int64Comparator(a, b interface{}) int {
-	aAsserted := a.(int64)
-	bAsserted := b.(int64)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func Int64Comparator(a, b int64) int { return OrderedComparator(a, b) }
 
 // UIntComparator provides a basic comparison on uint
-func UIntComparator(a, b interface{}) int {
-	aAsserted := a.(uint)
-	bAsserted := b.(uint)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func UIntComparator(a, b uint) int { return OrderedComparator(a, b) }
 
 // UInt8Comparator provides a basic comparison on uint8
-func UInt8Comparator(a, b interface{}) int {
-	aAsserted := a.(uint8)
-	bAsserted := b.(uint8)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func UInt8Comparator(a, b uint8) int { return OrderedComparator(a, b) }
 
 // UInt16Comparator provides a basic comparison on uint16
-func UInt16Comparator(a, b interface{}) int {
-	aAsserted := a.(uint16)
-	bAsserted := b.(uint16)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func UInt16Comparator(a, b uint16) int { return OrderedComparator(a, b) }
 
 // UInt32Comparator provides a basic comparison on uint32
-func UInt32Comparator(a, b interface{}) int {
-	aAsserted := a.(uint32)
-	bAsserted := b.(uint32)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func UInt32Comparator(a, b uint32) int { return OrderedComparator(a, b) }
 
 // UInt64Comparator provides a basic comparison on uint64
-func UInt64Comparator(a, b interface{}) int {
-	aAsserted := a.(uint64)
-	bAsserted := b.(uint64)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func UInt64Comparator(a, b uint64) int { return OrderedComparator(a, b) }
 
 // Float32Comparator provides a basic comparison on float32
-func Float32Comparator(a, b interface{}) int {
-	aAsserted := a.(float32)
-	bAsserted := b.(float32)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func Float32Comparator(a, b float32) int { return OrderedComparator(a, b) }
 
 // Float64Comparator provides a basic comparison on float64
-func Float64Comparator(a, b interface{}) int {
-	aAsserted := a.(float64)
-	bAsserted := b.(float64)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func Float64Comparator(a, b float64) int { return OrderedComparator(a, b) }
 
 // ByteComparator provides a basic comparison on byte
-func ByteComparator(a, b interface{}) int {
-	aAsserted := a.(byte)
-	bAsserted := b.(byte)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func ByteComparator(a, b byte) int { return OrderedComparator(a, b) }
 
 // RuneComparator provides a basic comparison on rune
-func RuneComparator(a, b interface{}) int {
-	aAsserted := a.(rune)
-	bAsserted := b.(rune)
-	switch {
-	case aAsserted > bAsserted:
-		return 1
-	case aAsserted < bAsserted:
-		return -1
-	default:
-		return 0
-	}
-}
+func RuneComparator(a, b rune) int { return OrderedComparator(a, b) }
 
 // TimeComparator provides a basic comparison on time.Time
-func TimeComparator(a, b interface{}) int {
-	aAsserted := a.(time.Time)
-	bAsserted := b.(time.Time)
-
+func TimeComparator(a, b time.Time) int {
 	switch {
-	case aAsserted.After(bAsserted):
+	case a.After(b):
 		return 1
-	case aAsserted.Before(bAsserted):
+	case a.Before(b):
 		return -1
 	default:
 		return 0
@@ -1,17 +1,16 @@
 package lazyskiplist
 
 import (
+	"iter"
 	"math/rand"
 	"sync"
-	"time"
+	"sync/atomic"
+
+	"skiplist/internal/backoff"
 
 	"github.com/petermattis/goid"
 )
 
-func init() {
-	rand.Seed(time.Now().Unix())
-}
-
 var (
 	// MaxHeight 128
 	MaxHeight = 128
@@ -23,41 +22,89 @@ type lSentinal struct{}
 // right setinal
 type rSentinal struct{}
 
-// Node is list node
+// Node is list node. Its links and flags are written under the node locks
+// but read without them, so they are atomics.
 type Node struct {
 	topLayer    int
-	fullyLinked bool
-	removed     bool
+	fullyLinked atomic.Bool
+	removed     atomic.Bool
 	lock        sync.Mutex
-	nexts       []*Node
+	nexts       []atomic.Pointer[Node]
 	Value       interface{}
 }
 
+// waitFullyLinked waits for the Add that is linking n to finish.
+func (n *Node) waitFullyLinked() {
+	var b backoff.Backoff
+	for !n.fullyLinked.Load() {
+		b.Wait()
+	}
+}
+
 // LazySkipList is the list structure for the algorithm
 type LazySkipList struct {
-	head  *Node
-	less  func(v1, v2 interface{}) bool
-	equal func(v1, v2 interface{}) bool
+	head   *Node
+	less   func(v1, v2 interface{}) bool
+	equal  func(v1, v2 interface{}) bool
+	levels LevelGenerator
+}
+
+// LevelGenerator returns the top layer, in [0, MaxHeight), of the next added
+// node. It must be safe for concurrent use.
+type LevelGenerator func() int
+
+// NewLevelGenerator returns a LevelGenerator seeded with seed, so that the
+// layers picked for a given sequence of Adds can be replayed.
+func NewLevelGenerator(seed int64) LevelGenerator {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return rng.Intn(MaxHeight)
+	}
+}
+
+// Option configures a LazySkipList at construction time.
+type Option func(*LazySkipList)
+
+// WithLevelGenerator makes the list pick the top layer of each node with g
+// instead of the global math/rand source.
+func WithLevelGenerator(g LevelGenerator) Option {
+	return func(l *LazySkipList) { l.levels = g }
 }
 
 // New receives a less function to help values sorted
 func New(less func(v1, v2 interface{}) bool, equal ...func(v1, v2 interface{}) bool) *LazySkipList {
+	var eq func(v1, v2 interface{}) bool
+	if len(equal) != 0 {
+		eq = equal[0]
+	}
+	return NewWithOptions(less, eq)
+}
+
+// NewWithOptions is New with the list configured by opts. equal may be nil.
+func NewWithOptions(less func(v1, v2 interface{}) bool, equal func(v1, v2 interface{}) bool, opts ...Option) *LazySkipList {
 	h := &Node{
-		topLayer:    MaxHeight,
-		fullyLinked: true,
-		nexts:       make([]*Node, MaxHeight),
-		Value:       lSentinal{},
+		topLayer: MaxHeight,
+		nexts:    make([]atomic.Pointer[Node], MaxHeight),
+		Value:    lSentinal{},
 	}
 	t := &Node{
-		topLayer:    MaxHeight,
-		fullyLinked: true,
-		Value:       rSentinal{},
+		topLayer: MaxHeight,
+		Value:    rSentinal{},
 	}
+	h.fullyLinked.Store(true)
+	t.fullyLinked.Store(true)
 	for i := range h.nexts {
-		h.nexts[i] = t
+		h.nexts[i].Store(t)
 	}
 	l := &LazySkipList{
-		head: h,
+		head:   h,
+		levels: func() int { return randomLevel(MaxHeight) },
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
 	l.less = func(v1, v2 interface{}) bool {
 		if _, ok := v1.(lSentinal); ok {
@@ -72,7 +119,7 @@ func New(less func(v1, v2 interface{}) bool, equal ...func(v1, v2 interface{}) b
 		return less(v1, v2)
 	}
 
-	if len(equal) != 0 {
+	if equal != nil {
 		l.equal = func(v1, v2 interface{}) bool {
 			if _, ok := v1.(lSentinal); ok {
 				return false
@@ -83,7 +130,7 @@ func New(less func(v1, v2 interface{}) bool, equal ...func(v1, v2 interface{}) b
 			if _, ok := v2.(rSentinal); ok {
 				return false
 			}
-			return equal[0](v1, v2)
+			return equal(v1, v2)
 		}
 	}
 	return l
@@ -93,11 +140,11 @@ func (l *LazySkipList) findNode(v interface{}, preds []*Node, succs []*Node) (fo
 	pred := l.head
 	found = -1
 	for layer := MaxHeight - 1; layer >= 0; layer-- {
-		curr := pred.nexts[layer]
+		curr := pred.nexts[layer].Load()
 		debugf("[%d/findNode] scan value %#v at layer %d, topLayer is %d", goid.Get(), curr.Value, layer, curr.topLayer)
 		for l.less(curr.Value, v) {
 			pred = curr
-			curr = pred.nexts[layer]
+			curr = pred.nexts[layer].Load()
 		}
 		// TODO: customize equal
 		if found == -1 && l.equal(v, curr.Value) {
@@ -114,9 +161,20 @@ func randomLevel(maxHeight int) int {
 	return rand.Intn(maxHeight)
 }
 
+func (l *LazySkipList) randomLevel() int {
+	topLayer := l.levels()
+	if topLayer < 0 {
+		return 0
+	}
+	if topLayer >= MaxHeight {
+		return MaxHeight - 1
+	}
+	return topLayer
+}
+
 // Add adds element in list
 func (l *LazySkipList) Add(v interface{}) {
-	topLayer := randomLevel(MaxHeight)
+	topLayer := l.randomLevel()
 	debugf("[%d/Add] adding value %#v, topLayer %d", goid.Get(), v, topLayer)
 	preds := make([]*Node, MaxHeight)
 	succs := make([]*Node, MaxHeight)
@@ -124,11 +182,9 @@ func (l *LazySkipList) Add(v interface{}) {
 		found := l.findNode(v, preds, succs)
 		if found != -1 {
 			nodeFound := succs[found]
-			if !nodeFound.removed {
+			if !nodeFound.removed.Load() {
 				debugf("[%d/Add] found value %#v, waiting for node fully linked", goid.Get(), v)
-				// Wait fullylinked marked
-				for !nodeFound.fullyLinked {
-				}
+				nodeFound.waitFullyLinked()
 				debugf("[%d/Add] found value %#v, node fully linked, return", goid.Get(), v)
 				return
 			}
@@ -150,18 +206,18 @@ func (l *LazySkipList) Add(v interface{}) {
 				highestLocked = layer
 				prevPred = pred
 			}
-			valid = !pred.removed && !succ.removed && pred.nexts[layer] == succ
+			valid = !pred.removed.Load() && !succ.removed.Load() && pred.nexts[layer].Load() == succ
 		}
 		if !valid {
 			unlock(preds, highestLocked)
 			continue
 		}
-		newNode := &Node{Value: v, topLayer: topLayer, nexts: make([]*Node, topLayer+1)}
+		newNode := &Node{Value: v, topLayer: topLayer, nexts: make([]atomic.Pointer[Node], topLayer+1)}
 		for layer := 0; layer <= topLayer; layer++ {
-			newNode.nexts[layer] = succs[layer]
-			preds[layer].nexts[layer] = newNode
+			newNode.nexts[layer].Store(succs[layer])
+			preds[layer].nexts[layer].Store(newNode)
 		}
-		newNode.fullyLinked = true
+		newNode.fullyLinked.Store(true)
 		debugf("[%d/Add] value %#v, topLayer %d, is added", goid.Get(), v, topLayer)
 		unlock(preds, highestLocked)
 		return
@@ -169,7 +225,7 @@ func (l *LazySkipList) Add(v interface{}) {
 }
 
 func okToDelete(candidate *Node, l int) bool {
-	return candidate.fullyLinked && candidate.topLayer == l && !candidate.removed
+	return candidate.fullyLinked.Load() && candidate.topLayer == l && !candidate.removed.Load()
 }
 
 // Remove removes a element in list
@@ -189,13 +245,13 @@ func (l *LazySkipList) Remove(v interface{}) {
 				topLayer = nodeToDelete.topLayer
 				debugf("[%d/Remove] lock node with value %#v, at layer %d, isRemoved=%t", goid.Get(), nodeToDelete.Value, nodeToDelete.topLayer, isRemoved)
 				nodeToDelete.lock.Lock()
-				if nodeToDelete.removed {
+				if nodeToDelete.removed.Load() {
 					debugf("[%d/Remove] value %#v, at layer %d, has been removed, unlock it", goid.Get(), v, nodeToDelete.topLayer)
 					nodeToDelete.lock.Unlock()
 					return
 				}
 				debugf("[%d/Remove] logically remove value %#v, at layer %d, isRemoved=%t", goid.Get(), nodeToDelete.Value, nodeToDelete.topLayer, isRemoved)
-				nodeToDelete.removed = true // logically removed
+				nodeToDelete.removed.Store(true) // logically removed
 				isRemoved = true
 			}
 			highestLocked := -1
@@ -210,7 +266,7 @@ func (l *LazySkipList) Remove(v interface{}) {
 					highestLocked = layer
 					prevPred = pred
 				}
-				valid = !pred.removed && pred.nexts[layer] == succ
+				valid = !pred.removed.Load() && pred.nexts[layer].Load() == succ
 			}
 			if !valid {
 				debugf("[%d/Remove] removing value %#v invalid, at layer %d, retry", goid.Get(), v, nodeToDelete.topLayer)
@@ -218,7 +274,7 @@ func (l *LazySkipList) Remove(v interface{}) {
 				continue
 			}
 			for layer := topLayer; layer >= 0; layer-- {
-				preds[layer].nexts[layer] = nodeToDelete.nexts[layer]
+				preds[layer].nexts[layer].Store(nodeToDelete.nexts[layer].Load())
 			}
 			debugf("[%d/Remove] value %#v is physically removed", goid.Get(), v)
 			unlock(preds, highestLocked)
@@ -249,7 +305,7 @@ func (l *LazySkipList) Contains(v interface{}) bool {
 	preds := make([]*Node, MaxHeight)
 	succs := make([]*Node, MaxHeight)
 	found := l.findNode(v, preds, succs)
-	return found != -1 && succs[found].fullyLinked && !succs[found].removed
+	return found != -1 && succs[found].fullyLinked.Load() && !succs[found].removed.Load()
 }
 
 // Iterator is used to iterate the list
@@ -263,13 +319,78 @@ func (i *Iterator) Next() (value interface{}, cont bool) {
 		return nil, false
 	}
 	value = i.curr.Value
-	i.curr = i.curr.nexts[0]
+	i.curr = i.curr.nexts[0].Load()
 	return value, true
 }
 
 // Iterator returns a Iterator
 func (l *LazySkipList) Iterator() Iterator {
 	return Iterator{
-		curr: l.head.nexts[0],
+		curr: l.head.nexts[0].Load(),
+	}
+}
+
+// All returns the values that are in the list, in ascending order, for use
+// with range-over-func loops. It sees values added or removed during the loop
+// or not depending on where they land relative to the walk.
+func (l *LazySkipList) All() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		l.walk(l.head.nexts[0].Load(), nil, yield)
+	}
+}
+
+// RangeSeq is All restricted to the values v with lo <= v < hi.
+func (l *LazySkipList) RangeSeq(lo, hi interface{}) iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		pred := l.head
+		for layer := MaxHeight - 1; layer >= 0; layer-- {
+			for curr := pred.nexts[layer].Load(); l.less(curr.Value, lo); curr = pred.nexts[layer].Load() {
+				pred = curr
+			}
+		}
+		l.walk(pred.nexts[0].Load(), hi, yield)
+	}
+}
+
+// Backward is All in descending order. Nodes have no back links, so each
+// step searches from the top for the last value below the current one, which
+// takes O(log n) instead of O(1).
+func (l *LazySkipList) Backward() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		for curr := l.lastBefore(rSentinal{}); curr != l.head; curr = l.lastBefore(curr.Value) {
+			if !yield(curr.Value) {
+				return
+			}
+		}
+	}
+}
+
+// lastBefore returns the last present node with a value below v, or the head
+// if there is none.
+func (l *LazySkipList) lastBefore(v interface{}) *Node {
+	for {
+		pred := l.head
+		for layer := MaxHeight - 1; layer >= 0; layer-- {
+			for curr := pred.nexts[layer].Load(); l.less(curr.Value, v); curr = pred.nexts[layer].Load() {
+				pred = curr
+			}
+		}
+		if pred == l.head || pred.fullyLinked.Load() && !pred.removed.Load() {
+			return pred
+		}
+		v = pred.Value
+	}
+}
+
+// walk yields the values of the present nodes from curr on, up to but not
+// including hi if it is not nil.
+func (l *LazySkipList) walk(curr *Node, hi interface{}, yield func(interface{}) bool) {
+	for ; l.less(curr.Value, rSentinal{}); curr = curr.nexts[0].Load() {
+		if hi != nil && !l.less(curr.Value, hi) {
+			return
+		}
+		if curr.fullyLinked.Load() && !curr.removed.Load() && !yield(curr.Value) {
+			return
+		}
 	}
 }
@@ -1,6 +1,9 @@
 package lazyskiplist
 
 import (
+	"reflect"
+	"runtime"
+	"sync"
 	"testing"
 )
 
@@ -37,3 +40,123 @@ func Test(t *testing.T) {
 		}
 	*/
 }
+
+func TestSeededLevels(t *testing.T) {
+	layers := func() []int {
+		l := NewWithOptions(func(v1, v2 interface{}) bool { return v1.(int) < v2.(int) }, func(v1, v2 interface{}) bool { return v1.(int) == v2.(int) }, WithLevelGenerator(NewLevelGenerator(5)))
+		for i := 0; i < 100; i++ {
+			l.Add(i)
+		}
+		var out []int
+		for n := l.head.nexts[0].Load(); n.nexts != nil; n = n.nexts[0].Load() {
+			out = append(out, n.topLayer)
+		}
+		return out
+	}
+	a, b := layers(), layers()
+	if len(a) != 100 {
+		t.Fatalf("expected 100 nodes, got %d", len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("node %d: top layer %d != %d", i, a[i], b[i])
+		}
+	}
+}
+
+func TestRangeFunc(t *testing.T) {
+	l := New(func(v1, v2 interface{}) bool { return v1.(int) < v2.(int) }, func(v1, v2 interface{}) bool { return v1.(int) == v2.(int) })
+	for i := 1; i <= 5; i++ {
+		l.Add(i)
+	}
+	l.Remove(3)
+	collect := func(seq func(func(interface{}) bool), stop int) []int {
+		ints := []int{}
+		for v := range seq {
+			ints = append(ints, v.(int))
+			if v.(int) == stop {
+				break
+			}
+		}
+		return ints
+	}
+	if ints := collect(l.All(), 0); !reflect.DeepEqual(ints, []int{1, 2, 4, 5}) {
+		t.Fatalf("All: %v", ints)
+	}
+	if ints := collect(l.All(), 2); !reflect.DeepEqual(ints, []int{1, 2}) {
+		t.Fatalf("All with break: %v", ints)
+	}
+	if ints := collect(l.Backward(), 2); !reflect.DeepEqual(ints, []int{5, 4, 2}) {
+		t.Fatalf("Backward: %v", ints)
+	}
+	// The walk is live: a snapshot would still yield 4.
+	ints := []int{}
+	for v := range l.Backward() {
+		if v.(int) == 5 {
+			l.Remove(4)
+		}
+		ints = append(ints, v.(int))
+	}
+	if !reflect.DeepEqual(ints, []int{5, 2, 1}) {
+		t.Fatalf("Backward with a removal: %v", ints)
+	}
+	l.Add(4)
+	if ints := collect(l.RangeSeq(2, 5), 0); !reflect.DeepEqual(ints, []int{2, 4}) {
+		t.Fatalf("Range: %v", ints)
+	}
+	if ints := collect(l.RangeSeq(6, 9), 0); len(ints) != 0 {
+		t.Fatalf("Range past the end: %v", ints)
+	}
+}
+
+// TestConcurrentStress races duplicate Adds of the same values against
+// Removes of them, which exercises waiting for a node that is still being
+// linked and removing a node while it is added. It runs once with
+// GOMAXPROCS=1, where a busy wait on fullyLinked would never give the adding
+// goroutine a chance to finish. Run it with -race.
+func TestConcurrentStress(t *testing.T) {
+	for _, procs := range []int{1, runtime.GOMAXPROCS(0)} {
+		prev := runtime.GOMAXPROCS(procs)
+		const (
+			goroutines = 8
+			iterations = 300
+			values     = 8
+		)
+		l := New(func(v1, v2 interface{}) bool { return v1.(int) < v2.(int) }, func(v1, v2 interface{}) bool { return v1.(int) == v2.(int) })
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					v := (i + g/2) % values
+					if g%2 == 0 {
+						l.Add(v)
+					} else {
+						l.Remove(v)
+					}
+					l.Contains(v)
+				}
+			}(g)
+		}
+		wg.Wait()
+		runtime.GOMAXPROCS(prev)
+
+		last := -1
+		iter := l.Iterator()
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if v.(int) <= last {
+				t.Fatalf("GOMAXPROCS=%d: %d after %d", procs, v, last)
+			}
+			if !l.Contains(v) {
+				t.Errorf("GOMAXPROCS=%d: iterated %d but Contains is false", procs, v)
+			}
+			last = v.(int)
+		}
+	}
+}
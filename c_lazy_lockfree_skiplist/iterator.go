@@ -0,0 +1,178 @@
+package lockfreeskiplist
+
+import (
+	"iter"
+
+	"skiplist/epoch"
+)
+
+// Iterator walks the bottom level of a LockFreeSkipList without locks or
+// retries. It is weakly consistent: running concurrently with Put and Delete,
+// it sees every key that is present for the whole scan exactly once, in
+// ascending order, and may or may not see keys added or deleted meanwhile.
+//
+// Deleted nodes are skipped. A marked node's links can no longer change, so
+// an iterator parked on a node that is deleted under it still finds its way
+// back into the list.
+//
+// With reclamation enabled, a positioned iterator holds a pinned guard, which
+// holds back recycling for the whole list until Close is called.
+type Iterator[K, V any] struct {
+	list  *LockFreeSkipList[K, V]
+	node  *Node[K, V]
+	value *valueRef[V] // as of when the iterator got to node
+	guard *epoch.Guard
+}
+
+// Iterator returns an iterator that is not yet positioned. Call SeekToFirst
+// or Seek before use.
+func (list *LockFreeSkipList[K, V]) Iterator() *Iterator[K, V] {
+	return &Iterator[K, V]{list: list}
+}
+
+// Valid returns true iff the iterator is positioned on a node.
+func (it *Iterator[K, V]) Valid() bool {
+	return it.node != nil && it.node != it.list.tail
+}
+
+// Key returns the key at the current position.
+func (it *Iterator[K, V]) Key() K { return it.node.key }
+
+// Value returns the value at the current position.
+func (it *Iterator[K, V]) Value() V { return it.value.value }
+
+// Next advances to the next node that is not deleted.
+func (it *Iterator[K, V]) Next() {
+	it.node, it.value = it.list.nextLive(it.node)
+}
+
+// SeekToFirst positions the iterator on the smallest key.
+func (it *Iterator[K, V]) SeekToFirst() {
+	it.pin()
+	it.node, it.value = it.list.nextLive(it.list.head)
+}
+
+// Seek positions the iterator on the smallest key >= key and reports whether
+// it is equal to key.
+func (it *Iterator[K, V]) Seek(key K) bool {
+	it.pin()
+	it.node, it.value = it.list.live(it.list.search(key))
+	return it.list.equal(it.node, key)
+}
+
+// Close unpositions the iterator and releases its guard, if any. The
+// iterator may be positioned again afterwards.
+func (it *Iterator[K, V]) Close() {
+	unpin(it.guard)
+	it.guard, it.node, it.value = nil, nil, nil
+}
+
+func (it *Iterator[K, V]) pin() {
+	if it.guard == nil {
+		it.guard = it.list.pin()
+	}
+}
+
+// All returns an iterator over the key/value pairs in ascending key order,
+// for use with range-over-func loops. It gives the same guarantees as
+// Iterator, and holds a guard only while the loop runs.
+func (list *LockFreeSkipList[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		defer unpin(list.pin())
+		for node, v := list.nextLive(list.head); node != list.tail; node, v = list.nextLive(node) {
+			if !yield(node.key, v.value) {
+				return
+			}
+		}
+	}
+}
+
+// Range calls fn on every key in [lo, hi) in ascending order until fn
+// returns false. It gives the same guarantees as Iterator.
+func (list *LockFreeSkipList[K, V]) Range(lo, hi K, fn func(key K, value V) bool) {
+	defer unpin(list.pin())
+	node, v := list.live(list.search(lo))
+	for ; node != list.tail && list.less(node, hi); node, v = list.nextLive(node) {
+		if !fn(node.key, v.value) {
+			return
+		}
+	}
+}
+
+// RangeSeq is All restricted to the keys in [lo, hi), the range-over-func
+// form of Range.
+func (list *LockFreeSkipList[K, V]) RangeSeq(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		defer unpin(list.pin())
+		node, v := list.live(list.search(lo))
+		for ; node != list.tail && list.less(node, hi); node, v = list.nextLive(node) {
+			if !yield(node.key, v.value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward is All in descending key order. Nodes have no back links, so each
+// step searches from the top for the last key below the current one, which
+// takes O(log n) instead of O(1).
+func (list *LockFreeSkipList[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		defer unpin(list.pin())
+		var key K
+		for node, v := list.lastBefore(key, false); node != list.head; node, v = list.lastBefore(node.key, true) {
+			if !yield(node.key, v.value) {
+				return
+			}
+		}
+	}
+}
+
+// lastBefore returns the last node that is not deleted, with its value, among
+// those with a key below key, or among all of them if bounded is false. It
+// returns the head if there is none. Like search, it does not modify the list.
+func (list *LockFreeSkipList[K, V]) lastBefore(key K, bounded bool) (*Node[K, V], *valueRef[V]) {
+	for {
+		var pred, curr, succ *Node[K, V] = list.head, nil, nil
+		var marked bool
+		for level := MaxLevel; level >= 0; level-- {
+			curr = pred.next[level].GetReference()
+			for {
+				succ, marked = curr.next[level].Get()
+				for marked {
+					curr = succ
+					succ, marked = curr.next[level].Get()
+				}
+				if curr == list.tail || bounded && !list.less(curr, key) {
+					break
+				}
+				pred = curr
+				curr = succ
+			}
+		}
+		if pred == list.head {
+			return pred, nil
+		}
+		if v := pred.value.Load(); v != list.deleted {
+			return pred, v
+		}
+		// pred is being deleted: look below it.
+		key, bounded = pred.key, true
+	}
+}
+
+// live returns the first node from node on at the bottom level that is not
+// deleted, with its value, or the tail.
+func (list *LockFreeSkipList[K, V]) live(node *Node[K, V]) (*Node[K, V], *valueRef[V]) {
+	for ; node != list.tail; node = node.next[0].GetReference() {
+		if v := node.value.Load(); v != list.deleted {
+			return node, v
+		}
+	}
+	return node, nil
+}
+
+// nextLive returns the first node after node that is not deleted.
+func (list *LockFreeSkipList[K, V]) nextLive(node *Node[K, V]) (*Node[K, V], *valueRef[V]) {
+	return list.live(node.next[0].GetReference())
+}
@@ -0,0 +1,200 @@
+package lockfreeskiplist
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	list := New[int, int](intCompare)
+	for _, k := range []int{5, 1, 9, 3, 7} {
+		list.Put(k, k*10)
+	}
+	list.Delete(9)
+
+	var keys []int
+	it := list.Iterator()
+	if it.Valid() {
+		t.Errorf("Expected unpositioned iterator to be invalid")
+	}
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if it.Value() != it.Key()*10 {
+			t.Errorf("Expected: %v, Got: %v", it.Key()*10, it.Value())
+		}
+		keys = append(keys, it.Key())
+	}
+	if expected := []int{1, 3, 5, 7}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("Expected: %v, Got: %v", expected, keys)
+	}
+
+	if it.Seek(4) || it.Key() != 5 {
+		t.Errorf("Seek(4): Got: %v", it.Key())
+	}
+	if !it.Seek(7) {
+		t.Errorf("Expected Seek(7) to find 7")
+	}
+	if it.Seek(8); it.Valid() {
+		t.Errorf("Expected Seek(8) to run off the end")
+	}
+}
+
+func TestIteratorParkedOnDeletedNode(t *testing.T) {
+	list := New[int, int](intCompare)
+	for k := 1; k <= 4; k++ {
+		list.Put(k, k)
+	}
+	it := list.Iterator()
+	it.Seek(2)
+	list.Delete(2)
+	list.Delete(3)
+	it.Next()
+	if !it.Valid() || it.Key() != 4 {
+		t.Errorf("Expected iterator to skip to 4")
+	}
+}
+
+func TestRange(t *testing.T) {
+	list := New[int, int](intCompare)
+	for k := 0; k < 10; k++ {
+		list.Put(k, k)
+	}
+
+	var keys []int
+	list.Range(3, 7, func(k, v int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if expected := []int{3, 4, 5, 6}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("Expected: %v, Got: %v", expected, keys)
+	}
+
+	keys = nil
+	list.Range(0, 10, func(k, v int) bool {
+		keys = append(keys, k)
+		return k < 2
+	})
+	if expected := []int{0, 1, 2}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("Expected: %v, Got: %v", expected, keys)
+	}
+
+	keys = nil
+	for k := range list.RangeSeq(3, 7) {
+		keys = append(keys, k)
+	}
+	if expected := []int{3, 4, 5, 6}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("Expected: %v, Got: %v", expected, keys)
+	}
+
+	keys = nil
+	for k := range list.RangeSeq(0, 10) {
+		keys = append(keys, k)
+		if k == 2 {
+			break
+		}
+	}
+	if expected := []int{0, 1, 2}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("Expected: %v, Got: %v", expected, keys)
+	}
+
+	list.Delete(5)
+	keys = nil
+	for k, v := range list.All() {
+		if k != v {
+			t.Errorf("Expected: %v, Got: %v", k, v)
+		}
+		keys = append(keys, k)
+	}
+	if expected := []int{0, 1, 2, 3, 4, 6, 7, 8, 9}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("Expected: %v, Got: %v", expected, keys)
+	}
+
+	keys = nil
+	for k := range list.Backward() {
+		if k == 9 {
+			// The walk is live: a snapshot would still yield 8.
+			list.Delete(8)
+		}
+		if k < 6 {
+			break
+		}
+		keys = append(keys, k)
+	}
+	if expected := []int{9, 7, 6}; !reflect.DeepEqual(expected, keys) {
+		t.Errorf("Expected: %v, Got: %v", expected, keys)
+	}
+}
+
+// TestConcurrentScan checks the documented guarantee: keys that stay in the
+// list for the whole scan are seen exactly once, in order, while other keys
+// come and go.
+func TestConcurrentScan(t *testing.T) {
+	const n = 2000
+	list := New[int, int](intCompare)
+	for k := 0; k < n; k += 2 {
+		list.Put(k, k)
+	}
+
+	var stop int32
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for atomic.LoadInt32(&stop) == 0 {
+				k := rng.Intn(n/2)*2 + 1
+				if rng.Intn(2) == 0 {
+					list.Put(k, k)
+				} else {
+					list.Delete(k)
+				}
+			}
+		}(g)
+	}
+
+	for scan := 0; scan < 50; scan++ {
+		prev, stable := -1, 0
+		check := func(k, v int) bool {
+			if k <= prev {
+				t.Fatalf("scan %d: %d after %d", scan, k, prev)
+			}
+			if k%2 == 0 {
+				if k != stable*2 {
+					t.Fatalf("scan %d: Expected: %v, Got: %v", scan, stable*2, k)
+				}
+				stable++
+			}
+			prev = k
+			return true
+		}
+		switch scan % 4 {
+		case 0:
+			list.Range(0, n, check)
+		case 1:
+			for k, v := range list.RangeSeq(0, n) {
+				check(k, v)
+			}
+		case 2:
+			it := list.Iterator()
+			for it.SeekToFirst(); it.Valid(); it.Next() {
+				check(it.Key(), it.Value())
+			}
+		default:
+			var keys []int
+			for k := range list.Backward() {
+				keys = append(keys, k)
+			}
+			for i := len(keys) - 1; i >= 0; i-- {
+				check(keys[i], keys[i])
+			}
+		}
+		if stable != n/2 {
+			t.Fatalf("scan %d: saw %d of %d stable keys", scan, stable, n/2)
+		}
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+}
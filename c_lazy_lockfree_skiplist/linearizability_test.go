@@ -0,0 +1,246 @@
+package lockfreeskiplist
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The tests in this file record concurrent histories of Put, Delete and
+// Contains and check that each one is linearizable: that there is a
+// sequential order of the operations, consistent with their real-time order,
+// in which every result matches a plain set. Linearizability is a local
+// property, so the history of every key can be checked on its own.
+
+type opKind int
+
+const (
+	opPut opKind = iota
+	opDelete
+	opContains
+)
+
+type operation struct {
+	kind      opKind
+	key       int
+	result    bool
+	call, ret int64
+}
+
+// apply runs op against a sequential set that holds the key iff present, and
+// returns the new state and whether op's recorded result is consistent.
+func (op operation) apply(present bool) (bool, bool) {
+	switch op.kind {
+	case opPut:
+		return true, op.result == !present
+	case opDelete:
+		return false, op.result == present
+	default:
+		return present, op.result == present
+	}
+}
+
+// linearizable searches for a legal linearization of history, which holds
+// the operations on a single key, starting from an absent key. It is the
+// Wing & Gong search with memoization of visited states.
+func linearizable(history []operation) bool {
+	if len(history) > 64 {
+		panic("history too long")
+	}
+	type state struct {
+		done    uint64
+		present bool
+	}
+	seen := map[state]bool{}
+	all := uint64(1)<<len(history) - 1
+	if len(history) == 64 {
+		all = ^uint64(0)
+	}
+
+	var search func(done uint64, present bool) bool
+	search = func(done uint64, present bool) bool {
+		if done == all {
+			return true
+		}
+		st := state{done, present}
+		if seen[st] {
+			return false
+		}
+		seen[st] = true
+
+		// An operation can go next only if no pending operation returned
+		// before it was called.
+		minRet := int64(1<<63 - 1)
+		for i, op := range history {
+			if done&(1<<i) == 0 && op.ret < minRet {
+				minRet = op.ret
+			}
+		}
+		for i, op := range history {
+			if done&(1<<i) != 0 || op.call > minRet {
+				continue
+			}
+			next, ok := op.apply(present)
+			if ok && search(done|1<<i, next) {
+				return true
+			}
+		}
+		return false
+	}
+	return search(0, false)
+}
+
+// recordHistories runs goroutines that each perform opsPerG random
+// operations on keys in [0, keys) and returns the history of every key.
+func recordHistories(t *testing.T, list *LockFreeSkipList[int, int], goroutines, opsPerG, keys int, seed int64) [][]operation {
+	t.Helper()
+	var clock int64
+	histories := make([][]operation, goroutines)
+
+	var start, wg sync.WaitGroup
+	start.Add(1)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(g)))
+			start.Wait()
+			for i := 0; i < opsPerG; i++ {
+				key := rng.Intn(keys)
+				op := operation{kind: opKind(rng.Intn(3)), key: key}
+				op.call = atomic.AddInt64(&clock, 1)
+				switch op.kind {
+				case opPut:
+					_, replaced := list.Put(key, g)
+					op.result = !replaced
+				case opDelete:
+					op.result = list.Delete(key)
+				default:
+					op.result = list.Contains(key)
+				}
+				op.ret = atomic.AddInt64(&clock, 1)
+				histories[g] = append(histories[g], op)
+				if rng.Intn(4) == 0 {
+					runtime.Gosched()
+				}
+			}
+		}(g)
+	}
+	start.Done()
+	wg.Wait()
+
+	byKey := make([][]operation, keys)
+	for _, h := range histories {
+		for _, op := range h {
+			byKey[op.key] = append(byKey[op.key], op)
+		}
+	}
+	return byKey
+}
+
+func TestLinearizableHistories(t *testing.T) {
+	const (
+		goroutines = 6
+		opsPerG    = 40
+		keys       = 6
+		rounds     = 50
+	)
+	for round := 0; round < rounds; round++ {
+		list := New[int, int](intCompare)
+		for key, history := range recordHistories(t, list, goroutines, opsPerG, keys, int64(round*goroutines)) {
+			if !linearizable(history) {
+				t.Fatalf("round %d: history of key %d is not linearizable: %+v", round, key, history)
+			}
+		}
+	}
+}
+
+func TestLinearizabilityChecker(t *testing.T) {
+	// Two overlapping Puts cannot both succeed.
+	bad := []operation{
+		{kind: opPut, result: true, call: 1, ret: 3},
+		{kind: opPut, result: true, call: 2, ret: 4},
+	}
+	if linearizable(bad) {
+		t.Errorf("Expected double insert to be rejected")
+	}
+
+	// A Contains that overlaps a Put may see either state.
+	good := []operation{
+		{kind: opPut, result: true, call: 1, ret: 4},
+		{kind: opContains, result: true, call: 2, ret: 3},
+		{kind: opDelete, result: true, call: 5, ret: 6},
+		{kind: opContains, result: false, call: 7, ret: 8},
+	}
+	if !linearizable(good) {
+		t.Errorf("Expected valid history to be accepted")
+	}
+
+	// Real-time order must be respected.
+	stale := []operation{
+		{kind: opPut, result: true, call: 1, ret: 2},
+		{kind: opContains, result: false, call: 3, ret: 4},
+	}
+	if linearizable(stale) {
+		t.Errorf("Expected stale read to be rejected")
+	}
+}
+
+// TestContendedDelete races many deleters and inserters on a handful of keys
+// and checks that every key's successful Puts and Deletes alternate.
+func TestContendedDelete(t *testing.T) {
+	const (
+		goroutines = 8
+		iterations = 5000
+		keys       = 4
+	)
+	list := New[int, int](intCompare)
+	var puts, deletes [keys]int64
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < iterations; i++ {
+				key := rng.Intn(keys)
+				if rng.Intn(2) == 0 {
+					if _, replaced := list.Put(key, g); !replaced {
+						atomic.AddInt64(&puts[key], 1)
+					}
+				} else if list.Delete(key) {
+					atomic.AddInt64(&deletes[key], 1)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	size := 0
+	for key := 0; key < keys; key++ {
+		diff := puts[key] - deletes[key]
+		if diff != 0 && diff != 1 {
+			t.Errorf("key %d: %d puts, %d deletes", key, puts[key], deletes[key])
+		}
+		if list.Contains(key) != (diff == 1) {
+			t.Errorf("key %d: Contains disagrees with %d puts, %d deletes", key, puts[key], deletes[key])
+		}
+		size += int(diff)
+	}
+	if list.Len() != size {
+		t.Errorf("Expected: %v, Got: %v", size, list.Len())
+	}
+
+	// Once quiescent, a final Delete leaves no node reachable at any level.
+	for key := 0; key < keys; key++ {
+		list.Delete(key)
+	}
+	for level := 0; level <= MaxLevel; level++ {
+		if next := list.head.next[level].GetReference(); next != list.tail {
+			t.Errorf("level %d still links a node", level)
+		}
+	}
+}
@@ -1,214 +1,348 @@
-package main
+// Package lockfreeskiplist is a lock-free concurrent skip list, following the
+// LockFreeSkipList of "The Art of Multiprocessor Programming", chapter 14.
+package lockfreeskiplist
 
 import (
 	"math/rand"
+	"sync"
 	"sync/atomic"
-	"time"
+
+	"skiplist/epoch"
 )
 
 const MaxLevel = 16
 const P = 0.5 // Probability of level increment
 
-type MarkableReference struct {
-	node   *Node
-	marked bool
+type Node[K, V any] struct {
+	// value is swapped atomically. The list's tombstone in place of a value
+	// means the node is being deleted.
+	value atomic.Pointer[valueRef[V]]
+	key   K
+	// next[i] links the node at level i. A mark on next[i] means the node is
+	// logically removed from level i; marking next[0] is what removes it from
+	// the set.
+	next     []MarkableReference[K, V]
+	topLevel int
+	pending  int32 // references held by Put and Delete, with reclamation
 }
 
-type Node struct {
-	value    int
-	key      int
-	next     []*atomic.Pointer[MarkableReference]
-	topLevel int
+// valueRef boxes a value so that it can be swapped with a single pointer.
+// deleted keeps the box from having zero size, which would let distinct boxes
+// share an address with the tombstone.
+type valueRef[V any] struct {
+	value   V
+	deleted bool
 }
 
-type LockFreeSkipList struct {
-	head *Node
-	tail *Node
+// LockFreeSkipList is an ordered set of keys, each carrying a value. The head
+// and tail are sentinel nodes that compare below and above every key, so the
+// whole key space is available to callers.
+type LockFreeSkipList[K, V any] struct {
+	head    *Node[K, V]
+	tail    *Node[K, V]
+	compare func(a, b K) int
+	levels  LevelGenerator
+	size    int64
+	deleted *valueRef[V]     // the tombstone
+	reclaim *reclaimer[K, V] // nil unless WithReclamation was given
 }
 
-func newNode(value int, height int) *Node {
-	n := &Node{
-		value:    value,
-		key:      value, // Using value as key for simplification
-		next:     make([]*atomic.Pointer[MarkableReference], height+1),
-		topLevel: height,
+// Option configures a LockFreeSkipList at construction time.
+type Option func(*options)
+
+type options struct {
+	levels    LevelGenerator
+	collector *epoch.Collector
+}
+
+// LevelGenerator returns the top level, in [0, MaxLevel], of a node about to
+// be added. It is called concurrently.
+type LevelGenerator func() int
+
+// WithLevelGenerator draws top levels from g instead of the global source.
+func WithLevelGenerator(g LevelGenerator) Option {
+	return func(o *options) { o.levels = g }
+}
+
+// NewLevelGenerator returns a LevelGenerator whose sequence of levels is
+// fixed by seed.
+func NewLevelGenerator(seed int64) LevelGenerator {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return geometricLevel(rng.Float64)
 	}
-	for i := range n.next {
-		n.next[i] = new(atomic.Pointer[MarkableReference])
-		mr := &MarkableReference{node: nil, marked: false}
-		n.next[i].Store(mr)
+}
+
+func geometricLevel(next func() float64) int {
+	level := 0
+	for next() < P && level < MaxLevel {
+		level++
+	}
+	return level
+}
+
+func newNode[K, V any](key K, height int) *Node[K, V] {
+	return &Node[K, V]{
+		key:      key,
+		next:     make([]MarkableReference[K, V], height+1),
+		topLevel: height,
 	}
-	return n
 }
 
-func NewLockFreeSkipList() *LockFreeSkipList {
-	head := newNode(-1, MaxLevel)
-	tail := newNode(int(^uint(0)>>1), MaxLevel)
+// New returns an empty list ordered by compare, which returns a negative
+// number, zero or a positive number when a is less than, equal to or greater
+// than b.
+func New[K, V any](compare func(a, b K) int, opts ...Option) *LockFreeSkipList[K, V] {
+	o := options{levels: func() int { return geometricLevel(rand.Float64) }}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var key K
+	head := newNode[K, V](key, MaxLevel)
+	tail := newNode[K, V](key, MaxLevel)
 	for i := range head.next {
-		mr := &MarkableReference{node: tail, marked: false}
-		head.next[i].Store(mr)
+		head.next[i].Set(tail, false)
+	}
+	list := &LockFreeSkipList[K, V]{
+		head:    head,
+		tail:    tail,
+		compare: compare,
+		levels:  o.levels,
+		deleted: &valueRef[V]{deleted: true},
 	}
-	return &LockFreeSkipList{
-		head: head,
-		tail: tail,
+	if o.collector != nil {
+		list.reclaim = newReclaimer[K, V](o.collector)
 	}
+	return list
 }
 
-func (list *LockFreeSkipList) randomLevel() int {
-	level := 0
-	for rand.Float64() < P && level < MaxLevel {
-		level++
+// Len returns the number of keys in the list.
+func (list *LockFreeSkipList[K, V]) Len() int {
+	return int(atomic.LoadInt64(&list.size))
+}
+
+func (list *LockFreeSkipList[K, V]) randomLevel() int {
+	level := list.levels()
+	if level < 0 {
+		return 0
+	}
+	if level > MaxLevel {
+		return MaxLevel
 	}
 	return level
 }
 
-func (list *LockFreeSkipList) Add(value int) bool {
-	topLevel := list.randomLevel()
-	preds := make([]*Node, MaxLevel+1)
-	succs := make([]*MarkableReference, MaxLevel+1)
+// less reports whether curr lies before key. The tail lies after every key.
+func (list *LockFreeSkipList[K, V]) less(curr *Node[K, V], key K) bool {
+	return curr != list.tail && list.compare(curr.key, key) < 0
+}
+
+// equal reports whether curr holds key.
+func (list *LockFreeSkipList[K, V]) equal(curr *Node[K, V], key K) bool {
+	return curr != list.tail && list.compare(curr.key, key) == 0
+}
+
+// Put stores value under key. If the key was present, it returns the value
+// it replaced, which is swapped out atomically.
+func (list *LockFreeSkipList[K, V]) Put(key K, value V) (old V, replaced bool) {
+	g := list.pin()
+	defer unpin(g)
+
+	var preds, succs [MaxLevel + 1]*Node[K, V]
+	var newNode *Node[K, V]
 	for {
-		found := list.find(value, preds, succs)
-		if found {
-			return false // Value already present
+		if list.find(g, key, &preds, &succs) {
+			curr := succs[0]
+			prev := curr.value.Load()
+			if prev == list.deleted {
+				list.unlink(g, curr)
+				continue
+			}
+			if !list.swapValue(g, curr, prev, value) {
+				continue
+			}
+			if newNode != nil {
+				list.discard(newNode)
+			}
+			return prev.value, true
 		}
 
-		newNode := newNode(value, topLevel)
-		for i := 0; i <= topLevel; i++ {
-			ref := succs[i]
-			newNode.next[i].Store(&MarkableReference{node: ref.node, marked: false})
+		if newNode == nil {
+			newNode = list.newNode(key, value, list.randomLevel())
 		}
-
-		pred := preds[0]
-		succ := succs[0]
-		if !pred.next[0].CompareAndSwap(succ, &MarkableReference{node: newNode, marked: false}) {
-			continue
+		if list.insert(g, newNode, &preds, &succs) {
+			return old, false
 		}
+	}
+}
 
-		for i := 1; i <= topLevel; i++ {
-			for {
-				pred = preds[i]
-				succ = succs[i]
-				if pred.next[i].CompareAndSwap(succ, &MarkableReference{node: newNode, marked: false}) {
-					break
-				}
-				list.find(value, preds, succs)
+// insert links newNode between preds and succs and reports whether it did.
+// It only fails if preds[0] no longer links to succs[0]; newNode can then be
+// inserted again after another find.
+func (list *LockFreeSkipList[K, V]) insert(g *epoch.Guard, newNode *Node[K, V], preds, succs *[MaxLevel + 1]*Node[K, V]) bool {
+	topLevel := newNode.topLevel
+	for level := 0; level <= topLevel; level++ {
+		list.store(&newNode.next[level], succs[level], false)
+	}
+
+	// Linking at the bottom level adds the key to the set.
+	pred := preds[0]
+	succ := succs[0]
+	if !list.cas(g, &pred.next[0], succ, newNode, false, false) {
+		return false
+	}
+	atomic.AddInt64(&list.size, 1)
+
+	// The upper levels are only shortcuts, so link them one at a time,
+	// searching again whenever a predecessor changed under us.
+link:
+	for level := 1; level <= topLevel; level++ {
+		for {
+			pred = preds[level]
+			succ = succs[level]
+
+			// The successor may have changed since newNode was built.
+			next, marked := newNode.next[level].Get()
+			if marked {
+				// newNode is already being removed; stop linking it.
+				break link
+			}
+			if next != succ && !list.cas(g, &newNode.next[level], next, succ, false, false) {
+				continue
 			}
+			if list.cas(g, &pred.next[level], succ, newNode, false, false) {
+				break
+			}
+			list.find(g, newNode.key, preds, succs)
 		}
-		return true
 	}
+	list.release(g, newNode)
+	return true
 }
 
-func (list *LockFreeSkipList) find(value int, preds []*Node, succs []*MarkableReference) bool {
-	var pred, curr *Node
-	var succ *MarkableReference
+// find fills preds and succs with the nodes surrounding key at every level,
+// unlinking marked nodes it meets on the way, and reports whether
+// succs[0] holds key.
+func (list *LockFreeSkipList[K, V]) find(g *epoch.Guard, key K, preds, succs *[MaxLevel + 1]*Node[K, V]) bool {
+	var pred, curr, succ *Node[K, V]
+	var marked bool
 retry:
 	for {
 		pred = list.head
 		for level := MaxLevel; level >= 0; level-- {
-			curr = pred.next[level].Load().node
-			for curr != list.tail && (curr.key < value || curr.next[level].Load().marked) {
+			curr = pred.next[level].GetReference()
+			for {
+				succ, marked = curr.next[level].Get()
+				for marked {
+					// curr is logically removed at this level: snip it.
+					if !list.cas(g, &pred.next[level], curr, succ, false, false) {
+						continue retry // pred changed or was marked itself
+					}
+					curr = succ
+					succ, marked = curr.next[level].Get()
+				}
+				if !list.less(curr, key) {
+					break
+				}
 				pred = curr
-				curr = pred.next[level].Load().node
+				curr = succ
 			}
 			preds[level] = pred
-			succs[level] = pred.next[level].Load()
-		}
-		succ = curr.next[0].Load()
-		if succ.marked {
-			continue retry // A marked node was reached; retry
+			succs[level] = curr
 		}
-		return curr.key == value
+		return list.equal(curr, key)
 	}
 }
 
-func (list *LockFreeSkipList) Contains(value int) bool {
-	var curr *Node = list.head
+// search walks down to the first unmarked node >= key without modifying the
+// list, which makes it wait-free. With reclamation the caller must be pinned.
+func (list *LockFreeSkipList[K, V]) search(key K) *Node[K, V] {
+	var pred, curr, succ *Node[K, V] = list.head, nil, nil
+	var marked bool
 	for level := MaxLevel; level >= 0; level-- {
-		curr = curr.next[level].Load().node
-		for curr.key < value {
-			curr = curr.next[level].Load().node
+		curr = pred.next[level].GetReference()
+		for {
+			succ, marked = curr.next[level].Get()
+			for marked {
+				curr = succ
+				succ, marked = curr.next[level].Get()
+			}
+			if !list.less(curr, key) {
+				break
+			}
+			pred = curr
+			curr = succ
 		}
 	}
-	return curr.key == value && !curr.next[0].Load().marked
+	return curr
 }
 
-func (list *LockFreeSkipList) Delete(value int) bool {
-	preds := make([]*Node, MaxLevel+1)
-	succs := make([]*MarkableReference, MaxLevel+1)
-
-	var victim *Node
-	var isMarked bool
-	var topLevel int
+// Contains reports whether key is present.
+func (list *LockFreeSkipList[K, V]) Contains(key K) bool {
+	_, ok := list.Get(key)
+	return ok
+}
 
-	for {
-		// Step 1: Find the node to delete, and its predecessors and successors.
-		found := list.find(value, preds, succs)
-		if !found {
-			victim = nil
-			return false // If the node is not found, return false.
+// Get returns the value stored under key.
+func (list *LockFreeSkipList[K, V]) Get(key K) (value V, ok bool) {
+	defer unpin(list.pin())
+	if curr := list.search(key); list.equal(curr, key) {
+		if v := curr.value.Load(); v != list.deleted {
+			return v.value, true
 		}
-		victim = succs[0].node
-		if !isMarked {
-			// Check if the node is already logically removed.
-			topLevel = victim.topLevel
-			victimNext := victim.next[topLevel].Load()
-			if victim != succs[topLevel].node || victimNext.marked {
-				return false // Victim node has changed, or already marked.
-			}
+	}
+	return value, false
+}
 
-			// Mark the node logically from the top level down.
-			isMarked = true
-			for level := topLevel; level >= 0; level-- {
-				succ := victim.next[level].Load()
-				if !succ.marked {
-					// Attempt to mark the node at each level.
-					expected := &MarkableReference{node: succ.node, marked: false}
-					newMark := &MarkableReference{node: succ.node, marked: true}
-					if !victim.next[level].CompareAndSwap(expected, newMark) {
-						isMarked = false
-						break // If marking fails, break and retry
-					}
-				}
-			}
-			if !isMarked {
-				continue // If marking failed, restart from finding the victim
-			}
-		}
+// Delete removes key and reports whether this call removed it.
+func (list *LockFreeSkipList[K, V]) Delete(key K) bool {
+	g := list.pin()
+	defer unpin(g)
 
-		// Step 2: Physically remove the node.
-		for level := topLevel; level >= 0; level-- {
-			pred := preds[level]
-			succ := succs[level]
-			next := victim.next[level].Load().node
-			// Attempt to unlink the victim node.
-			if !pred.next[level].CompareAndSwap(&MarkableReference{node: succ.node, marked: false}, &MarkableReference{node: next, marked: false}) {
-				isMarked = false // If CAS failed, set isMarked to false and retry
-				break
-			}
+	var preds, succs [MaxLevel + 1]*Node[K, V]
+	if !list.find(g, key, &preds, &succs) {
+		return false
+	}
+	for {
+		v := succs[0].value.Load()
+		if v == list.deleted {
+			return false
 		}
-		if !isMarked {
-			continue // If any CAS failed, retry
+		if list.remove(g, succs[0], v) {
+			return true
 		}
-		return true
 	}
 }
 
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	lfs := NewLockFreeSkipList()
-	lfs.Add(10)
-	lfs.Add(20)
-	lfs.Add(30)
-
-	added := lfs.Add(20) // should return false because 20 is already in the list
-	println("Added 20 again:", added)
-
-	contains := lfs.Contains(20)
-	println("Contains 20:", contains)
-
-	deleted := lfs.Delete(20)
-	println("Deleted 20:", deleted)
+// remove deletes curr if its value is still v. Swapping in the tombstone is
+// the linearization point, so a Put or CompareAndSwap that races with it
+// either takes effect before it or fails and starts over.
+func (list *LockFreeSkipList[K, V]) remove(g *epoch.Guard, curr *Node[K, V], v *valueRef[V]) bool {
+	if !curr.value.CompareAndSwap(v, list.deleted) {
+		return false
+	}
+	atomic.AddInt64(&list.size, -1)
+	list.retireValue(g, v)
+	list.unlink(g, curr)
+	list.release(g, curr)
+	return true
+}
 
-	contains = lfs.Contains(20)
-	println("Contains 20 after deletion:", contains)
+// unlink marks every level of a node holding the tombstone, top down, and
+// physically unlinks it as a side effect of find. Anyone who meets such a
+// node may call it to help the deleter along.
+func (list *LockFreeSkipList[K, V]) unlink(g *epoch.Guard, victim *Node[K, V]) {
+	for level := victim.topLevel; level >= 0; level-- {
+		succ, marked := victim.next[level].Get()
+		for !marked {
+			list.cas(g, &victim.next[level], succ, succ, false, true)
+			succ, marked = victim.next[level].Get()
+		}
+	}
+	var preds, succs [MaxLevel + 1]*Node[K, V]
+	list.find(g, victim.key, &preds, &succs)
 }
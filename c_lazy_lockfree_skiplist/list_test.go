@@ -0,0 +1,102 @@
+package lockfreeskiplist
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func intCompare(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	list := New[int, string](intCompare)
+	if _, replaced := list.Put(2, "two"); replaced {
+		t.Fatalf("Expected fresh key to be added")
+	}
+	list.Put(1, "one")
+	if old, replaced := list.Put(2, "TWO"); !replaced || old != "two" {
+		t.Errorf("Expected: %v, Got: %v", "two", old)
+	}
+	if v, ok := list.Get(2); !ok || v != "TWO" {
+		t.Errorf("Expected: %v, Got: %v", "TWO", v)
+	}
+	if _, ok := list.Get(3); ok {
+		t.Errorf("Expected missing key")
+	}
+	if list.Len() != 2 {
+		t.Errorf("Expected: %v, Got: %v", 2, list.Len())
+	}
+}
+
+func TestSentinelKeys(t *testing.T) {
+	// The sentinels are not keys, so the extremes of the key space are usable.
+	list := New[int, int](intCompare)
+	for _, k := range []int{math.MaxInt, math.MinInt, -1, 0} {
+		if _, replaced := list.Put(k, k); replaced {
+			t.Errorf("Put(%d) failed", k)
+		}
+	}
+	for _, k := range []int{math.MaxInt, math.MinInt, -1, 0} {
+		if !list.Contains(k) {
+			t.Errorf("Expected list to contain %d", k)
+		}
+	}
+	if list.Contains(1) {
+		t.Errorf("Expected list not to contain 1")
+	}
+}
+
+func TestConcurrentPut(t *testing.T) {
+	const n = 1000
+	list := New[string, int](strings.Compare, WithLevelGenerator(NewLevelGenerator(1)))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				list.Put(fmt.Sprintf("%05d", i), i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if list.Len() != n {
+		t.Errorf("Expected: %v, Got: %v", n, list.Len())
+	}
+	for i := 0; i < n; i++ {
+		if v, ok := list.Get(fmt.Sprintf("%05d", i)); !ok || v != i {
+			t.Fatalf("Expected: %v, Got: %v", i, v)
+		}
+	}
+}
+
+func Example() {
+	lfs := New[int, string](intCompare)
+	lfs.Put(10, "ten")
+	lfs.Put(20, "twenty")
+	lfs.Put(30, "thirty")
+
+	old, _ := lfs.Put(20, "again") // replaces the value in place
+	fmt.Println("Replaced:", old)
+
+	v, _ := lfs.Get(20)
+	fmt.Println("Get 20:", v)
+	fmt.Println("Contains 25:", lfs.Contains(25))
+	// Output:
+	// Replaced: twenty
+	// Get 20: again
+	// Contains 25: false
+}
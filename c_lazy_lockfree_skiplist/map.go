@@ -0,0 +1,119 @@
+package lockfreeskiplist
+
+import "skiplist/epoch"
+
+// The methods in this file give the list the semantics of sync.Map, on top
+// of keeping its keys in order. Values are swapped atomically on the node
+// that holds the key, so none of them relinks the tower of a present key.
+
+// LoadOrStore returns the value stored under key if it is present.
+// Otherwise it stores value and returns it. loaded reports which happened.
+func (list *LockFreeSkipList[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	g := list.pin()
+	defer unpin(g)
+
+	var preds, succs [MaxLevel + 1]*Node[K, V]
+	var newNode *Node[K, V]
+	for {
+		if list.find(g, key, &preds, &succs) {
+			curr := succs[0]
+			v := curr.value.Load()
+			if v == list.deleted {
+				list.unlink(g, curr)
+				continue
+			}
+			if newNode != nil {
+				list.discard(newNode)
+			}
+			return v.value, true
+		}
+
+		if newNode == nil {
+			newNode = list.newNode(key, value, list.randomLevel())
+		}
+		if list.insert(g, newNode, &preds, &succs) {
+			return value, false
+		}
+	}
+}
+
+// CompareAndSwap stores new under key if the value stored under key is equal
+// to old, and reports whether it did. Like sync.Map, it panics if the values
+// are not comparable.
+func (list *LockFreeSkipList[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	g := list.pin()
+	defer unpin(g)
+
+	for {
+		curr := list.search(key)
+		if !list.equal(curr, key) {
+			return false
+		}
+		v := curr.value.Load()
+		// A node that is being deleted no longer holds the key, and no new
+		// node for it can be linked before this one is marked.
+		if v == list.deleted || any(v.value) != any(old) {
+			return false
+		}
+		if list.swapValue(g, curr, v, new) {
+			return true
+		}
+	}
+}
+
+// Compute atomically replaces the value stored under key with the result of
+// fn, which is passed the current value and whether the key is present. If
+// fn returns keep = false, the key is deleted, or not added. Compute returns
+// the value now stored and whether the key is present.
+//
+// fn may be called more than once if other goroutines change the key at the
+// same time, so it should have no side effects.
+func (list *LockFreeSkipList[K, V]) Compute(key K, fn func(old V, loaded bool) (value V, keep bool)) (value V, ok bool) {
+	g := list.pin()
+	defer unpin(g)
+
+	var preds, succs [MaxLevel + 1]*Node[K, V]
+	for {
+		if list.find(g, key, &preds, &succs) {
+			curr := succs[0]
+			v := curr.value.Load()
+			if v == list.deleted {
+				list.unlink(g, curr)
+				continue
+			}
+			newValue, keep := fn(v.value, true)
+			if keep && list.swapValue(g, curr, v, newValue) {
+				return newValue, true
+			}
+			if !keep && list.remove(g, curr, v) {
+				return value, false
+			}
+			continue
+		}
+
+		var zero V
+		newValue, keep := fn(zero, false)
+		if !keep {
+			return value, false
+		}
+		newNode := list.newNode(key, newValue, list.randomLevel())
+		if list.insert(g, newNode, &preds, &succs) {
+			return newValue, true
+		}
+		list.discard(newNode)
+	}
+}
+
+// swapValue replaces v, the current value of curr, with value and reports
+// whether it was still current.
+func (list *LockFreeSkipList[K, V]) swapValue(g *epoch.Guard, curr *Node[K, V], v *valueRef[V], value V) bool {
+	newRef := list.valueRef(value)
+	if !curr.value.CompareAndSwap(v, newRef) {
+		if list.reclaim != nil {
+			list.reclaim.values.Put(newRef)
+		}
+		return false
+	}
+	list.retireValue(g, v)
+	return true
+}
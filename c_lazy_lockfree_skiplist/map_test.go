@@ -0,0 +1,118 @@
+package lockfreeskiplist
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"skiplist/epoch"
+)
+
+func TestLoadOrStore(t *testing.T) {
+	list := New[int, string](intCompare)
+	if v, loaded := list.LoadOrStore(1, "one"); loaded || v != "one" {
+		t.Errorf("Expected: %v, Got: %v", "one", v)
+	}
+	if v, loaded := list.LoadOrStore(1, "uno"); !loaded || v != "one" {
+		t.Errorf("Expected: %v, Got: %v", "one", v)
+	}
+	list.Delete(1)
+	if v, loaded := list.LoadOrStore(1, "uno"); loaded || v != "uno" {
+		t.Errorf("Expected: %v, Got: %v", "uno", v)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	list := New[int, string](intCompare)
+	if list.CompareAndSwap(1, "", "one") {
+		t.Errorf("Expected CompareAndSwap on a missing key to fail")
+	}
+	list.Put(1, "one")
+	if list.CompareAndSwap(1, "two", "three") {
+		t.Errorf("Expected CompareAndSwap with a stale value to fail")
+	}
+	if !list.CompareAndSwap(1, "one", "two") {
+		t.Errorf("Expected CompareAndSwap to succeed")
+	}
+	if v, _ := list.Get(1); v != "two" {
+		t.Errorf("Expected: %v, Got: %v", "two", v)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	list := New[int, int](intCompare)
+	incr := func(old int, loaded bool) (int, bool) { return old + 1, true }
+
+	if v, ok := list.Compute(1, incr); !ok || v != 1 {
+		t.Errorf("Expected: %v, Got: %v", 1, v)
+	}
+	if v, ok := list.Compute(1, incr); !ok || v != 2 {
+		t.Errorf("Expected: %v, Got: %v", 2, v)
+	}
+
+	drop := func(old int, loaded bool) (int, bool) { return 0, false }
+	if _, ok := list.Compute(1, drop); ok || list.Contains(1) || list.Len() != 0 {
+		t.Errorf("Expected Compute to delete the key")
+	}
+	if _, ok := list.Compute(2, drop); ok || list.Contains(2) {
+		t.Errorf("Expected Compute not to add the key")
+	}
+}
+
+// TestConcurrentUpdates counts with Compute and CompareAndSwap from many
+// goroutines while others delete and re-add unrelated keys, and checks that
+// no increment is lost.
+func TestConcurrentUpdates(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithReclamation(epoch.NewCollector())}} {
+		const (
+			goroutines = 8
+			iterations = 2000
+			keys       = 4
+		)
+		list := New[int, int](intCompare, opts...)
+
+		var stop int32
+		var churn sync.WaitGroup
+		churn.Add(1)
+		go func() {
+			defer churn.Done()
+			for i := 0; atomic.LoadInt32(&stop) == 0; i++ {
+				list.Put(keys+i%16, i)
+				list.Delete(keys + (i+8)%16)
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					key := (g + i) % keys
+					if g%2 == 0 {
+						list.Compute(key, func(old int, loaded bool) (int, bool) { return old + 1, true })
+						continue
+					}
+					for {
+						old, loaded := list.LoadOrStore(key, 1)
+						if !loaded || list.CompareAndSwap(key, old, old+1) {
+							break
+						}
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		atomic.StoreInt32(&stop, 1)
+		churn.Wait()
+
+		total := 0
+		for key := 0; key < keys; key++ {
+			v, _ := list.Get(key)
+			total += v
+		}
+		if total != goroutines*iterations {
+			t.Errorf("Expected: %v, Got: %v", goroutines*iterations, total)
+		}
+	}
+}
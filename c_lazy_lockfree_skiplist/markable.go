@@ -0,0 +1,76 @@
+package lockfreeskiplist
+
+import "sync/atomic"
+
+// MarkableReference is a node reference paired with a mark bit that can be
+// updated together atomically, like Java's AtomicMarkableReference.
+//
+// Go has no spare pointer bits to tag, so every (node, marked) state lives in
+// an immutable box and the reference swaps boxes. CompareAndSet compares the
+// contents of the current box with the expected values and then CASes on
+// the identity of that very box, so a concurrent change between the two is
+// always detected. A zero MarkableReference holds (nil, false).
+type MarkableReference[K, V any] struct {
+	p atomic.Pointer[markedRef[K, V]]
+}
+
+type markedRef[K, V any] struct {
+	node   *Node[K, V]
+	marked bool
+}
+
+// Get returns the reference and mark.
+func (r *MarkableReference[K, V]) Get() (node *Node[K, V], marked bool) {
+	_, node, marked = r.load()
+	return node, marked
+}
+
+// load returns the current box along with its contents.
+func (r *MarkableReference[K, V]) load() (*markedRef[K, V], *Node[K, V], bool) {
+	if b := r.p.Load(); b != nil {
+		return b, b.node, b.marked
+	}
+	return nil, nil, false
+}
+
+// GetReference returns the reference.
+func (r *MarkableReference[K, V]) GetReference() *Node[K, V] {
+	node, _ := r.Get()
+	return node
+}
+
+// IsMarked returns the mark.
+func (r *MarkableReference[K, V]) IsMarked() bool {
+	_, marked := r.Get()
+	return marked
+}
+
+// Set unconditionally stores the reference and mark.
+func (r *MarkableReference[K, V]) Set(node *Node[K, V], marked bool) {
+	r.p.Store(&markedRef[K, V]{node: node, marked: marked})
+}
+
+// CompareAndSet sets the reference and mark to newNode and newMark if they
+// currently are expectedNode and expectedMark.
+func (r *MarkableReference[K, V]) CompareAndSet(expectedNode, newNode *Node[K, V], expectedMark, newMark bool) bool {
+	cur, node, marked := r.load()
+	if node != expectedNode || marked != expectedMark {
+		return false
+	}
+	if node == newNode && marked == newMark {
+		return true
+	}
+	return r.p.CompareAndSwap(cur, &markedRef[K, V]{node: newNode, marked: newMark})
+}
+
+// AttemptMark sets the mark to newMark if the reference is expectedNode.
+func (r *MarkableReference[K, V]) AttemptMark(expectedNode *Node[K, V], newMark bool) bool {
+	cur, node, marked := r.load()
+	if node != expectedNode {
+		return false
+	}
+	if marked == newMark {
+		return true
+	}
+	return r.p.CompareAndSwap(cur, &markedRef[K, V]{node: node, marked: newMark})
+}
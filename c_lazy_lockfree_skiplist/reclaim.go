@@ -0,0 +1,160 @@
+package lockfreeskiplist
+
+import (
+	"sync/atomic"
+
+	"skiplist/epoch"
+)
+
+// WithReclamation recycles unlinked nodes and the boxes replaced by every
+// MarkableReference update through free lists guarded by c, instead of
+// leaving them to the garbage collector. Every operation pins a guard of c
+// while it runs; an Iterator stays pinned until it is closed.
+func WithReclamation(c *epoch.Collector) Option {
+	return func(o *options) { o.collector = c }
+}
+
+// reclaimer holds the free lists of a list with reclamation enabled. Nodes
+// are pooled by top level so that their next slices can be reused as is.
+type reclaimer[K, V any] struct {
+	collector *epoch.Collector
+	boxes     *epoch.Pool[markedRef[K, V]]
+	values    *epoch.Pool[valueRef[V]]
+	nodes     [MaxLevel + 1]*epoch.Pool[Node[K, V]]
+}
+
+func newReclaimer[K, V any](c *epoch.Collector) *reclaimer[K, V] {
+	r := &reclaimer[K, V]{collector: c}
+	r.boxes = epoch.NewPool(func(b *markedRef[K, V]) { *b = markedRef[K, V]{} })
+	r.values = epoch.NewPool(func(v *valueRef[V]) { *v = valueRef[V]{} })
+	for i := range r.nodes {
+		r.nodes[i] = epoch.NewPool(func(n *Node[K, V]) {
+			// A node's current boxes go out of use with it.
+			for i := range n.next {
+				if b := n.next[i].p.Swap(nil); b != nil {
+					r.boxes.Put(b)
+				}
+			}
+			// Its value is the tombstone unless it was never linked.
+			if v := n.value.Swap(nil); v != nil && !v.deleted {
+				r.values.Put(v)
+			}
+			var zero K
+			n.key = zero
+		})
+	}
+	return r
+}
+
+// pin returns a pinned guard, or nil if reclamation is disabled.
+func (list *LockFreeSkipList[K, V]) pin() *epoch.Guard {
+	if list.reclaim == nil {
+		return nil
+	}
+	return list.reclaim.collector.Pin()
+}
+
+func unpin(g *epoch.Guard) {
+	if g != nil {
+		g.Unpin()
+	}
+}
+
+// newNode returns a node that is not yet linked, recycled if possible. With
+// reclamation, both its inserter and its deleter hold a reference that keeps
+// the node from being retired while they still work on it.
+func (list *LockFreeSkipList[K, V]) newNode(key K, value V, height int) *Node[K, V] {
+	var n *Node[K, V]
+	if list.reclaim != nil {
+		n = list.reclaim.nodes[height].Get()
+	}
+	if n == nil {
+		n = newNode[K, V](key, height)
+	}
+	n.key = key
+	n.value.Store(list.valueRef(value))
+	n.pending = 2
+	return n
+}
+
+// valueRef returns a box holding value.
+func (list *LockFreeSkipList[K, V]) valueRef(value V) *valueRef[V] {
+	if list.reclaim != nil {
+		if v := list.reclaim.values.Get(); v != nil {
+			v.value = value
+			return v
+		}
+	}
+	return &valueRef[V]{value: value}
+}
+
+// retireValue recycles a value box that was swapped out.
+func (list *LockFreeSkipList[K, V]) retireValue(g *epoch.Guard, v *valueRef[V]) {
+	if list.reclaim != nil {
+		g.Retire(v, list.reclaim.values)
+	}
+}
+
+// discard drops a node that was never linked.
+func (list *LockFreeSkipList[K, V]) discard(n *Node[K, V]) {
+	if list.reclaim != nil {
+		list.reclaim.nodes[n.topLevel].Put(n)
+	}
+}
+
+// release drops the reference of the inserter or of the deleter to a node.
+// The last one makes sure it is unlinked at every level, which a slow
+// inserter may have undone, and retires it.
+func (list *LockFreeSkipList[K, V]) release(g *epoch.Guard, n *Node[K, V]) {
+	if list.reclaim == nil || atomic.AddInt32(&n.pending, -1) != 0 {
+		return
+	}
+	var preds, succs [MaxLevel + 1]*Node[K, V]
+	list.find(g, n.key, &preds, &succs)
+	g.Retire(n, list.reclaim.nodes[n.topLevel])
+}
+
+// box returns a box holding node and marked.
+func (list *LockFreeSkipList[K, V]) box(node *Node[K, V], marked bool) *markedRef[K, V] {
+	if b := list.reclaim.boxes.Get(); b != nil {
+		b.node, b.marked = node, marked
+		return b
+	}
+	return &markedRef[K, V]{node: node, marked: marked}
+}
+
+// store sets a reference of a node that is not yet linked, so the box it
+// replaces has never been seen by anyone else.
+func (list *LockFreeSkipList[K, V]) store(r *MarkableReference[K, V], node *Node[K, V], marked bool) {
+	if list.reclaim == nil {
+		r.Set(node, marked)
+		return
+	}
+	if old := r.p.Swap(list.box(node, marked)); old != nil {
+		list.reclaim.boxes.Put(old)
+	}
+}
+
+// cas is MarkableReference.CompareAndSet that takes the new box from the free
+// list and retires the replaced one.
+func (list *LockFreeSkipList[K, V]) cas(g *epoch.Guard, r *MarkableReference[K, V], expectedNode, newNode *Node[K, V], expectedMark, newMark bool) bool {
+	if list.reclaim == nil {
+		return r.CompareAndSet(expectedNode, newNode, expectedMark, newMark)
+	}
+	cur, node, marked := r.load()
+	if node != expectedNode || marked != expectedMark {
+		return false
+	}
+	if node == newNode && marked == newMark {
+		return true
+	}
+	b := list.box(newNode, newMark)
+	if !r.p.CompareAndSwap(cur, b) {
+		list.reclaim.boxes.Put(b)
+		return false
+	}
+	if cur != nil {
+		g.Retire(cur, list.reclaim.boxes)
+	}
+	return true
+}
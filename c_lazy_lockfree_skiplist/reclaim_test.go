@@ -0,0 +1,109 @@
+package lockfreeskiplist
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"skiplist/epoch"
+)
+
+func TestReclamationAllocs(t *testing.T) {
+	list := New[int, int](intCompare, WithReclamation(epoch.NewCollector()), WithLevelGenerator(NewLevelGenerator(1)))
+	for k := 0; k < 100; k += 2 {
+		list.Put(k, k)
+	}
+	churn := func() {
+		for k := 1; k < 100; k += 2 {
+			list.Put(k, k)
+		}
+		for k := 1; k < 100; k += 2 {
+			list.Delete(k)
+		}
+	}
+	// Warm up the free lists.
+	for i := 0; i < 20; i++ {
+		churn()
+	}
+
+	// Each churn is 100 operations; without reclamation every one of them
+	// allocates at least a node or a box.
+	if allocs := testing.AllocsPerRun(100, churn); allocs > 10 {
+		t.Errorf("Expected: <= 10 allocations per 100 operations, Got: %v", allocs)
+	}
+	if list.Len() != 50 {
+		t.Errorf("Expected: %v, Got: %v", 50, list.Len())
+	}
+}
+
+// TestReclamationStress churns a small key space from many goroutines while
+// others read. A node or box recycled too early would show up as a value
+// that does not belong to its key, or as a race.
+func TestReclamationStress(t *testing.T) {
+	const (
+		goroutines = 8
+		iterations = 5000
+		keys       = 64
+	)
+	list := New[int, int](intCompare, WithReclamation(epoch.NewCollector()))
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < iterations; i++ {
+				key := rng.Intn(keys)
+				switch rng.Intn(4) {
+				case 0:
+					list.Put(key, -key)
+				case 1:
+					list.Delete(key)
+				case 2:
+					if v, ok := list.Get(key); ok && v != -key {
+						t.Errorf("Get(%d) = %d", key, v)
+					}
+				default:
+					prev := -1
+					list.Range(0, keys, func(k, v int) bool {
+						if k <= prev || v != -k {
+							t.Errorf("Range saw %d:%d after %d", k, v, prev)
+						}
+						prev = k
+						return true
+					})
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	n := 0
+	it := list.Iterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		n++
+	}
+	it.Close()
+	if n != list.Len() {
+		t.Errorf("Expected: %v, Got: %v", list.Len(), n)
+	}
+}
+
+func TestLinearizableHistoriesWithReclamation(t *testing.T) {
+	const (
+		goroutines = 6
+		opsPerG    = 40
+		keys       = 6
+		rounds     = 20
+	)
+	c := epoch.NewCollector()
+	for round := 0; round < rounds; round++ {
+		list := New[int, int](intCompare, WithReclamation(c))
+		for key, history := range recordHistories(t, list, goroutines, opsPerG, keys, int64(round*goroutines)) {
+			if !linearizable(history) {
+				t.Fatalf("round %d: history of key %d is not linearizable: %+v", round, key, history)
+			}
+		}
+	}
+}
@@ -20,6 +20,8 @@ package arenaskl
 import (
 	"errors"
 	"math"
+	"math/bits"
+	"sync"
 	"sync/atomic"
 	"unsafe"
 )
@@ -28,6 +30,60 @@ import (
 type Arena struct {
 	n   uint64
 	buf []byte
+
+	// A chained arena has no buf. It allocates from blocks of 1<<shift bytes
+	// instead, adding them as it fills up, so an offset is the index of a
+	// block followed by the position within it, which can take more than 32
+	// bits. Blocks are only ever added, by copying the slice under mu.
+	shift  uint32
+	blocks atomic.Pointer[[][]byte]
+	made   uint64 // blocks that are not nil
+	mu     sync.Mutex
+
+	// Space handed back by Free, made on first use. Reset drops it and bumps
+	// gen, so that spans retired by a skiplist that used the arena before
+	// Reset, and freed only after, are dropped too.
+	free atomic.Pointer[freeLists]
+	gen  uint64
+}
+
+// Free spans are kept by size class: 8 byte steps up to 1KB, then powers of
+// two, so that class k < 128 holds the spans of 8k to 8k+7 bytes.
+const (
+	smallClasses = 128
+	numClasses   = smallClasses + 22
+)
+
+type freeLists struct {
+	gen     uint64
+	n       int64 // spans in classes, so that Alloc only looks when there are any
+	classes [numClasses]freeList
+}
+
+type freeList struct {
+	mu    sync.Mutex
+	spans []freeSpan
+}
+
+type freeSpan struct {
+	offset uint64
+	size   uint32
+}
+
+// classFloor returns the class a span of size bytes goes in.
+func classFloor(size uint32) int {
+	if size < smallClasses*8 {
+		return int(size / 8)
+	}
+	return smallClasses + bits.Len32(size) - 11
+}
+
+// classCeil returns the smallest class whose spans all hold size bytes.
+func classCeil(size uint32) int {
+	if size <= smallClasses*8 {
+		return int((size + 7) / 8)
+	}
+	return smallClasses + bits.Len32(size-1) - 10
 }
 
 type Align uint8
@@ -43,6 +99,11 @@ var (
 	ErrArenaFull = errors.New("allocation failed because arena is full")
 )
 
+// maxChainedSize bounds the offsets of a chained arena to 48 bits, which is
+// what a value offset takes in a node, and more than the address space of
+// current 64-bit machines.
+const maxChainedSize = 1 << 48
+
 // NewArena allocates a new arena of the specified size and returns it.
 func NewArena(size uint32) *Arena {
 	// Don't store data at position 0 in order to reserve offset=0 as a kind
@@ -55,24 +116,144 @@ func NewArena(size uint32) *Arena {
 	return out
 }
 
-func (a *Arena) Size() uint32 {
+// NewChainedArena returns an arena that grows by blockSize bytes at a time,
+// for as long as memory lasts. blockSize must be a power of two greater than
+// one, and no single allocation, such as a node with its key or value, may be
+// larger than a block. The offsets of a chained arena do not fit in 32 bits,
+// so skiplists lay out their nodes with wider links on it.
+func NewChainedArena(blockSize uint32) *Arena {
+	if blockSize < 2 || blockSize&(blockSize-1) != 0 {
+		panic("blockSize must be a power of two greater than one")
+	}
+
+	out := &Arena{
+		n:     1,
+		shift: uint32(bits.TrailingZeros32(blockSize)),
+	}
+	out.blocks.Store(&[][]byte{})
+	return out
+}
+
+func (a *Arena) Size() uint64 {
 	s := atomic.LoadUint64(&a.n)
-	if s > math.MaxUint32 {
+	if a.shift == 0 && s > math.MaxUint32 {
 		// Saturate at MaxUint32.
 		return math.MaxUint32
 	}
-	return uint32(s)
+	return s
+}
+
+// Cap returns the number of bytes the arena holds. Of a chained arena, that
+// is only the blocks it has made so far.
+func (a *Arena) Cap() uint64 {
+	if a.shift != 0 {
+		return atomic.LoadUint64(&a.made) << a.shift
+	}
+	return uint64(len(a.buf))
 }
 
-func (a *Arena) Cap() uint32 {
-	return uint32(len(a.buf))
+// wide reports whether offsets in the arena can take more than 32 bits.
+func (a *Arena) wide() bool {
+	return a.shift != 0
 }
 
 func (a *Arena) Reset() {
+	atomic.AddUint64(&a.gen, 1)
+	a.free.Store(nil)
 	atomic.StoreUint64(&a.n, 1)
 }
 
-func (a *Arena) Alloc(size, overflow uint32, align Align) (uint32, error) {
+// generation returns the number of times the arena has been reset.
+func (a *Arena) generation() uint64 {
+	return atomic.LoadUint64(&a.gen)
+}
+
+// Free hands the size bytes at offset back to the arena, to be reused by a
+// later Alloc of the same size class. No one may read or write them after.
+func (a *Arena) Free(offset uint64, size uint32) {
+	a.freeGen(a.generation(), offset, size)
+}
+
+// freeGen is Free for space allocated in the given generation of the arena.
+// The space is dropped if the arena has been reset since.
+func (a *Arena) freeGen(gen uint64, offset uint64, size uint32) {
+	if offset == 0 || size == 0 {
+		return
+	}
+
+	free := a.free.Load()
+	if free == nil {
+		a.free.CompareAndSwap(nil, &freeLists{gen: a.generation()})
+		free = a.free.Load()
+	}
+	if free == nil || free.gen != gen {
+		return
+	}
+	list := &free.classes[classFloor(size)]
+	list.mu.Lock()
+	list.spans = append(list.spans, freeSpan{offset, size})
+	list.mu.Unlock()
+	atomic.AddInt64(&free.n, 1)
+}
+
+// allocFree tries to take a span that holds size bytes, aligned, followed by
+// overflow more, from the free lists. It looks in the class of size first,
+// where records of the same size leave their spans, and then in the smallest
+// class whose spans all hold size bytes.
+func (a *Arena) allocFree(size, overflow uint32, align Align) (uint64, bool) {
+	free := a.free.Load()
+	if free == nil {
+		return 0, false
+	}
+	if offset, ok := a.takeFree(free, classFloor(size), size, overflow, align); ok {
+		return offset, true
+	}
+	if k := classCeil(size); k != classFloor(size) && k < numClasses {
+		return a.takeFree(free, k, size, overflow, align)
+	}
+	return 0, false
+}
+
+// takeFree takes the last span of class k if it holds the allocation.
+func (a *Arena) takeFree(free *freeLists, k int, size, overflow uint32, align Align) (uint64, bool) {
+	list := &free.classes[k]
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	n := len(list.spans)
+	if n == 0 {
+		return 0, false
+	}
+	span := list.spans[n-1]
+	offset := (span.offset + uint64(align)) & ^uint64(align)
+	if offset+uint64(size) > span.offset+uint64(span.size) || !a.fits(offset, size+overflow) {
+		// Too small, misaligned for this allocation, or too close to the end.
+		return 0, false
+	}
+	list.spans = list.spans[:n-1]
+	atomic.AddInt64(&free.n, -1)
+	return offset, true
+}
+
+// fits reports whether the size bytes at offset are all in one block, or in
+// buf.
+func (a *Arena) fits(offset uint64, size uint32) bool {
+	if a.shift != 0 {
+		return offset&(1<<a.shift-1)+uint64(size) <= 1<<a.shift
+	}
+	return offset+uint64(size) <= uint64(len(a.buf))
+}
+
+func (a *Arena) Alloc(size, overflow uint32, align Align) (uint64, error) {
+	if free := a.free.Load(); free != nil && atomic.LoadInt64(&free.n) > 0 {
+		if offset, ok := a.allocFree(size, overflow, align); ok {
+			return offset, nil
+		}
+	}
+
+	if a.shift != 0 {
+		return a.allocChained(size, overflow, align)
+	}
+
 	// Verify that the arena isn't already full.
 	origSize := atomic.LoadUint64(&a.n)
 	if int(origSize) > len(a.buf) {
@@ -91,29 +272,106 @@ func (a *Arena) Alloc(size, overflow uint32, align Align) (uint32, error) {
 
 	// Return the aligned offset.
 	offset := (uint32(newSize) - padded + uint32(align)) & ^uint32(align)
-	return offset, nil
+	return uint64(offset), nil
 }
 
-func (a *Arena) GetBytes(offset uint32, size uint32) []byte {
+func (a *Arena) GetBytes(offset uint64, size uint32) []byte {
 	if offset == 0 {
 		return nil
 	}
 
-	return a.buf[offset : offset+size]
+	if a.shift != 0 {
+		block, i := a.block(offset)
+		return block[i : i+uint64(size)]
+	}
+	return a.buf[offset : offset+uint64(size)]
 }
 
-func (a *Arena) GetPointer(offset uint32) unsafe.Pointer {
+func (a *Arena) GetPointer(offset uint64) unsafe.Pointer {
 	if offset == 0 {
 		return nil
 	}
 
+	if a.shift != 0 {
+		block, i := a.block(offset)
+		return unsafe.Pointer(&block[i])
+	}
 	return unsafe.Pointer(&a.buf[offset])
 }
 
-func (a *Arena) GetPointerOffset(ptr unsafe.Pointer) uint32 {
+// GetPointerOffset returns the offset of ptr. In a chained arena, this takes
+// time linear in the number of blocks, which is why wide nodes keep their own.
+func (a *Arena) GetPointerOffset(ptr unsafe.Pointer) uint64 {
 	if ptr == nil {
 		return 0
 	}
 
-	return uint32(uintptr(ptr) - uintptr(unsafe.Pointer(&a.buf[0])))
+	if a.shift != 0 {
+		// The newest blocks are the likeliest to hold ptr.
+		blocks := *a.blocks.Load()
+		for i := len(blocks) - 1; i >= 0; i-- {
+			if blocks[i] == nil {
+				continue
+			}
+			pos := uintptr(ptr) - uintptr(unsafe.Pointer(&blocks[i][0]))
+			if pos < uintptr(len(blocks[i])) {
+				return uint64(i)<<a.shift | uint64(pos)
+			}
+		}
+		panic("pointer is not in the arena")
+	}
+	return uint64(uintptr(ptr) - uintptr(unsafe.Pointer(&a.buf[0])))
+}
+
+// allocChained is Alloc for a chained arena. Like Alloc, it claims space by
+// moving n along, here across the concatenation of all blocks. An allocation
+// that would straddle two blocks leaves the rest of the first one unused and
+// tries again in the next one.
+func (a *Arena) allocChained(size, overflow uint32, align Align) (uint64, error) {
+	padded := uint64(size) + uint64(align)
+	if padded+uint64(overflow) > 1<<a.shift {
+		return 0, ErrArenaFull
+	}
+
+	for {
+		newSize := atomic.AddUint64(&a.n, padded)
+		start, end := newSize-padded, newSize+uint64(overflow)
+		if end > maxChainedSize {
+			return 0, ErrArenaFull
+		}
+		if start>>a.shift != (end-1)>>a.shift {
+			continue
+		}
+
+		a.grow(int(start >> a.shift))
+		offset := (start + uint64(align)) & ^uint64(align)
+		return offset, nil
+	}
+}
+
+// grow makes sure that the block with the given index exists. Blocks before
+// it are left to the allocations that land in them, which only matters when
+// n starts out past the first block.
+func (a *Arena) grow(index int) {
+	if blocks := *a.blocks.Load(); index < len(blocks) && blocks[index] != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	blocks := *a.blocks.Load()
+	if index < len(blocks) && blocks[index] != nil {
+		return
+	}
+	grown := make([][]byte, max(len(blocks), index+1))
+	copy(grown, blocks)
+	grown[index] = make([]byte, 1<<a.shift)
+	a.blocks.Store(&grown)
+	atomic.AddUint64(&a.made, 1)
+}
+
+// block returns the block that holds offset in a chained arena, and the
+// position of offset within it.
+func (a *Arena) block(offset uint64) ([]byte, uint64) {
+	return (*a.blocks.Load())[offset>>a.shift], offset & (1<<a.shift - 1)
 }
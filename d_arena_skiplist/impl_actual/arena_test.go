@@ -18,9 +18,13 @@
 package arenaskl
 
 import (
+	"fmt"
 	"math"
+	"sync"
 	"testing"
 
+	"skiplist/epoch"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,17 +36,220 @@ func TestArenaSizeOverflow(t *testing.T) {
 	// Allocating under the limit throws no error.
 	offset, err := a.Alloc(math.MaxUint16, 0, Align1)
 	require.Nil(t, err)
-	require.Equal(t, uint32(1), offset)
-	require.Equal(t, uint32(math.MaxUint16)+1, a.Size())
+	require.Equal(t, uint64(1), offset)
+	require.Equal(t, uint64(math.MaxUint16)+1, a.Size())
 
 	// Allocating over the limit could cause an accounting
 	// overflow if 32-bit arithmetic was used. It shouldn't.
 	_, err = a.Alloc(math.MaxUint32, 0, Align1)
 	require.Equal(t, ErrArenaFull, err)
-	require.Equal(t, uint32(math.MaxUint32), a.Size())
+	require.Equal(t, uint64(math.MaxUint32), a.Size())
 
 	// Continuing to allocate continues to throw an error.
 	_, err = a.Alloc(math.MaxUint16, 0, Align1)
 	require.Equal(t, ErrArenaFull, err)
-	require.Equal(t, uint32(math.MaxUint32), a.Size())
+	require.Equal(t, uint64(math.MaxUint32), a.Size())
+}
+
+// TestChainedArena tests that a chained arena adds blocks as it fills up and
+// never splits an allocation across two of them.
+func TestChainedArena(t *testing.T) {
+	a := NewChainedArena(64)
+	require.Equal(t, uint64(0), a.Cap())
+
+	offset, err := a.Alloc(40, 0, Align1)
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), offset)
+	copy(a.GetBytes(offset, 40), "first")
+
+	// Does not fit in what is left of the first block.
+	offset, err = a.Alloc(30, 8, Align8)
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), offset>>6)
+	require.Equal(t, uint64(0), offset%8)
+	require.Equal(t, uint64(128), a.Cap())
+	copy(a.GetBytes(offset, 30), "second")
+
+	require.Equal(t, "first", string(a.GetBytes(1, 5)))
+	require.Equal(t, "second", string(a.GetBytes(offset, 6)))
+	require.Equal(t, offset, a.GetPointerOffset(a.GetPointer(offset)))
+	require.Equal(t, uint64(20), a.GetPointerOffset(a.GetPointer(20)))
+
+	// Allocations larger than a block always fail.
+	_, err = a.Alloc(60, 8, Align1)
+	require.Equal(t, ErrArenaFull, err)
+
+	// The blocks skipped by an arena that starts further on do not count.
+	a = newWideArena()
+	_, err = a.Alloc(8, 0, Align8)
+	require.Nil(t, err)
+	require.Equal(t, uint64(1<<16), a.Cap())
+}
+
+// TestArenaFree tests that freed spans are handed out again by Alloc, as long
+// as they hold the allocation.
+func TestArenaFree(t *testing.T) {
+	a := NewArena(1 << 10)
+
+	small, err := a.Alloc(5, 0, Align1)
+	require.Nil(t, err)
+	big, err := a.Alloc(40, 0, Align8)
+	require.Nil(t, err)
+	size := a.Size()
+
+	a.Free(small, 5)
+	a.Free(big, 40)
+
+	// Too large for the small span, so it comes from the end.
+	offset, err := a.Alloc(6, 0, Align1)
+	require.Nil(t, err)
+	require.NotEqual(t, small, offset)
+	size = a.Size()
+
+	offset, err = a.Alloc(5, 0, Align1)
+	require.Nil(t, err)
+	require.Equal(t, small, offset)
+
+	offset, err = a.Alloc(33, 0, Align8)
+	require.Nil(t, err)
+	require.Equal(t, big, offset)
+	require.Equal(t, size, a.Size())
+
+	// Reset forgets about freed spans.
+	a.Free(offset, 33)
+	gen := a.generation()
+	a.Reset()
+	offset, err = a.Alloc(33, 0, Align8)
+	require.Nil(t, err)
+	require.Equal(t, uint64(8), offset)
+
+	// Space from before Reset, freed after it, is dropped.
+	a.freeGen(gen, big, 40)
+	offset, err = a.Alloc(33, 0, Align8)
+	require.Nil(t, err)
+	require.NotEqual(t, big, offset)
+	a.freeGen(a.generation(), offset, 33)
+	reused, err := a.Alloc(33, 0, Align8)
+	require.Nil(t, err)
+	require.Equal(t, offset, reused)
+}
+
+// TestChainedArenaSkiplist tests that a skiplist on a chained arena keeps
+// growing past the size of a block.
+func TestChainedArenaSkiplist(t *testing.T) {
+	const n = 2000
+	l := NewSkiplist(NewChainedArena(4096))
+	l.testing = true
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var it Iterator
+			it.Init(l)
+			for i := g; i < n; i += 4 {
+				require.Nil(t, it.Add([]byte(fmt.Sprintf("%05d", i)), newValue(i), 0))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	require.Greater(t, l.Size(), uint64(16*4096))
+	require.Equal(t, n, length(l))
+	require.Equal(t, n, lengthRev(l))
+
+	var it Iterator
+	it.Init(l)
+	for i := 0; i < n; i++ {
+		require.True(t, it.Seek([]byte(fmt.Sprintf("%05d", i))))
+		require.EqualValues(t, newValue(i), it.Value())
+	}
+}
+
+// newWideArena returns a chained arena that starts just short of 4GB, with
+// the blocks before left unmade, so that offsets soon take more than 32 bits.
+func newWideArena() *Arena {
+	a := NewChainedArena(1 << 16)
+	a.n = 1<<32 - 1<<12
+	return a
+}
+
+// TestChainedArenaWideOffsets tests skiplists on a chained arena past 4GB.
+func TestChainedArenaWideOffsets(t *testing.T) {
+	const n = 2000
+	for _, opts := range [][]Option{nil, {WithReclamation(epoch.NewCollector())}} {
+		l := NewSkiplist(newWideArena(), opts...)
+
+		var it Iterator
+		it.Init(l)
+		for i := 0; i < n; i++ {
+			require.Nil(t, it.Add(newValue(i), newValue(i), uint16(i)))
+		}
+		require.Greater(t, it.nd.getOffset(l.arena), uint64(math.MaxUint32))
+		require.Greater(t, it.nd.getKeyOffset(l.arena), uint64(math.MaxUint32))
+		require.Greater(t, it.value&valueLocationMask, uint64(math.MaxUint32))
+		require.Equal(t, ErrRecordExists, it.Add(newValue(7), nil, 0))
+
+		for i := 0; i < n; i++ {
+			require.True(t, it.Seek(newValue(i)))
+			require.EqualValues(t, newValue(i), it.Value())
+			require.EqualValues(t, i, it.Meta())
+			switch i % 3 {
+			case 0:
+				require.Nil(t, it.Set([]byte("set"), 0))
+			case 1:
+				require.Nil(t, it.SetMeta(uint16(n+i)))
+			case 2:
+				require.Nil(t, it.Delete())
+			}
+		}
+		it.Close()
+		require.Equal(t, n-n/3, length(l))
+		require.Equal(t, n-n/3, lengthRev(l))
+
+		it.Init(l)
+		require.True(t, it.Seek(newValue(3)))
+		require.EqualValues(t, "set", it.Value())
+		require.True(t, it.Seek(newValue(4)))
+		require.EqualValues(t, newValue(4), it.Value())
+		require.EqualValues(t, n+4, it.Meta())
+		require.False(t, it.Seek(newValue(5)))
+		require.False(t, it.SeekForPrev(newValue(5)))
+		require.EqualValues(t, newValue(4), it.Key())
+
+		// A tombstone is neither a value nor a deleted record.
+		require.Nil(t, it.put(newValue(5), nil, 0, kindTombstone))
+		require.True(t, it.Tombstone())
+		require.Empty(t, it.Value())
+		require.Nil(t, it.put(newValue(5), []byte("back"), 0, kindValue))
+		require.False(t, it.Tombstone())
+		require.EqualValues(t, "back", it.Value())
+		it.Close()
+
+		// Compaction goes both ways between plain and chained arenas.
+		plain, _, err := l.CompactInto(NewArena(arenaSize))
+		require.Nil(t, err)
+		require.Equal(t, records(l), records(plain))
+		wide, _, err := plain.CompactInto(newWideArena())
+		require.Nil(t, err)
+		require.Equal(t, records(l), records(wide))
+		require.Equal(t, length(l), lengthRev(wide))
+	}
+
+	// Versions keep their sequence numbers in the key.
+	l := NewSkiplist(newWideArena(), WithVersions())
+	var it Iterator
+	it.Init(l)
+	for i := 0; i < n; i++ {
+		require.Nil(t, it.Add(newValue(i%10), newValue(i), 0))
+	}
+	snap := l.NewSnapshot()
+	require.Nil(t, it.AddTombstone(newValue(3)))
+	it.InitAt(l, snap)
+	require.True(t, it.Seek(newValue(3)))
+	require.EqualValues(t, newValue(n-7), it.Value())
+	it.Init(l)
+	require.False(t, it.Seek(newValue(3)))
+	require.Equal(t, 9, length(l))
 }
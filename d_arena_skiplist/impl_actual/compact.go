@@ -0,0 +1,161 @@
+package arenaskl
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CompactInto copies the live records of the skiplist, in order, into a new
+// skiplist on arena, leaving behind deleted records and the values replaced
+// by Set. Of a versioned skiplist, it copies the version of each key that is
+// visible at NewSnapshot, unless that is a tombstone. Records are appended at
+// the end of every level rather than added, so the copy takes O(n).
+//
+// The new skiplist is constructed with the options of s, and reclaimed is how
+// many fewer bytes it takes. If arena cannot hold the copy, CompactInto fails
+// with ErrArenaFull. Records that are added or changed in s while CompactInto
+// runs may or may not be copied; CompactingSkiplist keeps writers out.
+func (s *Skiplist) CompactInto(arena *Arena) (list *Skiplist, reclaimed uint64, err error) {
+	list, err = newSkiplist(arena, s.opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var it Iterator
+	if s.versioned {
+		snap := s.NewSnapshot()
+		it.InitAt(s, snap)
+		list.seq, list.visible = snap, snap
+	} else {
+		it.Init(s)
+	}
+	defer it.Close()
+
+	var prevs [maxHeight]*node
+	for i := range prevs {
+		prevs[i] = list.head
+	}
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		kind := uint64(kindValue)
+		if it.Tombstone() {
+			kind = kindTombstone
+		}
+		nd, height, err := list.newNode(it.nd.getKey(it.arena), it.Value(), it.Meta(), kind)
+		if err != nil {
+			return nil, 0, err
+		}
+		if list.collector != nil {
+			// Only the deleter holds a reference.
+			nd.setRefs(list.arena, 1)
+		}
+		list.appendNode(&prevs, nd, height)
+	}
+
+	if old, size := s.Size(), list.Size(); old > size {
+		reclaimed = old - size
+	}
+	return list, reclaimed, nil
+}
+
+// appendNode links nd after prevs, the last node of every level so far, of a
+// skiplist that no one else can see yet.
+func (s *Skiplist) appendNode(prevs *[maxHeight]*node, nd *node, height uint32) {
+	arena := s.arena
+	ndOffset := nd.getOffset(arena)
+	tailOffset := s.tail.getOffset(arena)
+	for i := 0; i < int(height); i++ {
+		prev := prevs[i]
+		nd.setPrevOffset(arena, i, prev.getOffset(arena))
+		nd.setNextOffset(arena, i, tailOffset)
+		prev.setNextOffset(arena, i, ndOffset)
+		s.tail.setPrevOffset(arena, i, ndOffset)
+		prevs[i] = nd
+	}
+}
+
+// CompactingSkiplist holds a skiplist that Compact replaces with a compacted
+// copy. Readers go through Read, and keep working on a skiplist after it is
+// replaced, since its arena is left alone until the last of them is done.
+// Writers go through Write, so that nothing they do is lost to a concurrent
+// Compact.
+type CompactingSkiplist struct {
+	cur atomic.Pointer[compactedList]
+	mu  sync.RWMutex // held by writers, and exclusively by Compact
+}
+
+// compactedList is a skiplist of a CompactingSkiplist with the count of the
+// Reads of it, plus one while it is the current skiplist.
+type compactedList struct {
+	list *Skiplist
+	refs atomic.Int32
+	done chan struct{} // closed once refs drops to zero
+}
+
+func (l *compactedList) unref() {
+	if l.refs.Add(-1) == 0 {
+		close(l.done)
+	}
+}
+
+// NewCompactingSkiplist returns a CompactingSkiplist that starts out with
+// list.
+func NewCompactingSkiplist(list *Skiplist) *CompactingSkiplist {
+	c := &CompactingSkiplist{}
+	c.cur.Store(newCompactedList(list))
+	return c
+}
+
+func newCompactedList(list *Skiplist) *compactedList {
+	l := &compactedList{list: list, done: make(chan struct{})}
+	l.refs.Store(1)
+	return l
+}
+
+// Load returns the current skiplist. Unlike Read, it does not keep Compact
+// from reporting the skiplist's arena as free once it is replaced.
+func (c *CompactingSkiplist) Load() *Skiplist { return c.cur.Load().list }
+
+// Read calls fn with the current skiplist, which fn may keep reading after
+// a Compact replaces it. Reads never wait for writers or for Compact.
+func (c *CompactingSkiplist) Read(fn func(list *Skiplist) error) error {
+	for {
+		l := c.cur.Load()
+		// A skiplist whose count dropped to zero has been replaced, and its
+		// arena may be in use again.
+		if refs := l.refs.Load(); refs > 0 && l.refs.CompareAndSwap(refs, refs+1) {
+			defer l.unref()
+			return fn(l.list)
+		}
+	}
+}
+
+// Write calls fn with the current skiplist. Any number of writers can run at
+// once, but not while Compact does.
+func (c *CompactingSkiplist) Write(fn func(list *Skiplist) error) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return fn(c.cur.Load().list)
+}
+
+// Compact copies the current skiplist into arena with CompactInto and swaps
+// the copy in. If the copy fails, the current skiplist stays.
+//
+// Compact waits for the running writers and keeps new ones waiting until the
+// copy is swapped in, which takes O(n) in the number of records. Readers are
+// not held up.
+//
+// The returned channel is closed once no Read of the replaced skiplist is
+// running anymore. From then on its arena can be reset and reused, provided
+// that it is not read through Load either.
+func (c *CompactingSkiplist) Compact(arena *Arena) (reclaimed uint64, released <-chan struct{}, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.cur.Load()
+	list, reclaimed, err := old.list.CompactInto(arena)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.cur.Store(newCompactedList(list))
+	old.unref()
+	return reclaimed, old.done, nil
+}
@@ -0,0 +1,195 @@
+package arenaskl
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"skiplist/epoch"
+
+	"github.com/stretchr/testify/require"
+)
+
+// records returns the key=value pairs of list, in order.
+func records(list *Skiplist) []string {
+	var out []string
+	for key, val := range list.All() {
+		out = append(out, string(key)+"="+string(val))
+	}
+	return out
+}
+
+// TestCompactInto tests that compaction keeps the live records and leaves
+// deleted records and replaced values behind.
+func TestCompactInto(t *testing.T) {
+	const n = 500
+	l := NewSkiplist(NewArena(arenaSize))
+
+	var it Iterator
+	it.Init(l)
+	for i := 0; i < n; i++ {
+		require.Nil(t, it.Add(newValue(i), newValue(i), uint16(i)))
+		for j := 0; j < 3; j++ {
+			require.Nil(t, it.Set([]byte(fmt.Sprintf("%d-%d", i, j)), uint16(i)))
+		}
+		if i%2 == 1 {
+			require.Nil(t, it.Delete())
+		}
+	}
+
+	c, reclaimed, err := l.CompactInto(NewArena(arenaSize))
+	require.Nil(t, err)
+	require.Equal(t, l.Size()-c.Size(), reclaimed)
+	require.Greater(t, reclaimed, c.Size())
+
+	require.Equal(t, records(l), records(c))
+	require.Equal(t, n/2, length(c))
+	require.Equal(t, n/2, lengthRev(c))
+
+	it.Init(c)
+	require.True(t, it.Seek(newValue(42)))
+	require.EqualValues(t, "42-2", it.Value())
+	require.EqualValues(t, 42, it.Meta())
+	require.False(t, it.Seek(newValue(43)))
+
+	// The copy is an ordinary skiplist.
+	require.Nil(t, it.Add(newValue(43), []byte("new"), 0))
+	require.Equal(t, ErrRecordExists, it.Add(newValue(44), []byte("new"), 0))
+	require.Equal(t, n/2+1, lengthRev(c))
+
+	// An arena that is too small fails the copy, even one without room for
+	// the head and tail.
+	_, _, err = l.CompactInto(NewArena(4096))
+	require.Equal(t, ErrArenaFull, err)
+	_, _, err = l.CompactInto(NewArena(uint32(MaxNodeSize)))
+	require.Equal(t, ErrArenaFull, err)
+}
+
+// TestCompactVersions tests that compacting a versioned skiplist keeps only
+// the visible version of each key, and that sequence numbers carry on.
+func TestCompactVersions(t *testing.T) {
+	l := NewSkiplist(NewArena(arenaSize), WithVersions(), WithComparer(reverse))
+
+	var it Iterator
+	it.Init(l)
+	for i := 0; i < 10; i++ {
+		require.Nil(t, it.Add([]byte("a"), newValue(i), 0))
+		require.Nil(t, it.Add([]byte("b"), newValue(i), 0))
+	}
+	require.Nil(t, it.AddTombstone([]byte("b")))
+	snap := l.NewSnapshot()
+
+	c, _, err := l.CompactInto(NewArena(arenaSize))
+	require.Nil(t, err)
+	require.Equal(t, []string{"a=00009"}, records(c))
+	require.Equal(t, snap, c.NewSnapshot())
+
+	it.Init(c)
+	require.Nil(t, it.Add([]byte("b"), []byte("new"), 0))
+	require.Nil(t, it.Add([]byte("c"), []byte("new"), 0))
+	require.Equal(t, snap+2, c.NewSnapshot())
+	require.Equal(t, []string{"c=new", "b=new", "a=00009"}, records(c))
+
+	it.InitAt(c, snap)
+	it.SeekToFirst()
+	require.EqualValues(t, "a", it.Key())
+	it.Next()
+	require.False(t, it.Valid())
+}
+
+// reverse orders keys from the largest to the smallest.
+func reverse(a, b []byte) int { return bytes.Compare(b, a) }
+
+// TestCompactingSkiplist tests that readers of a replaced skiplist keep
+// working while writers and compactions go on.
+func TestCompactingSkiplist(t *testing.T) {
+	const n = 1000
+	c := NewCompactingSkiplist(NewSkiplist(NewArena(arenaSize)))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < n; i += 4 {
+				err := c.Write(func(list *Skiplist) error {
+					var it Iterator
+					it.Init(list)
+					defer it.Close()
+					if err := it.Add(newValue(i), newValue(i), 0); err != nil {
+						return err
+					}
+					return it.Set([]byte("updated"), 0)
+				})
+				require.Nil(t, err)
+			}
+		}(g)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			// A reader that holds on to a skiplist across compactions.
+			var released <-chan struct{}
+			require.Nil(t, c.Read(func(list *Skiplist) error {
+				before := length(list)
+				var err error
+				_, released, err = c.Compact(NewArena(arenaSize))
+				require.Nil(t, err)
+				require.GreaterOrEqual(t, length(list), before)
+				select {
+				case <-released:
+					t.Error("arena released while it is read")
+				default:
+				}
+				return nil
+			}))
+			<-released
+		}
+	}()
+	wg.Wait()
+
+	list := c.Load()
+	require.Equal(t, n, length(list))
+	for _, val := range list.All() {
+		require.EqualValues(t, "updated", val)
+	}
+
+	_, released, err := c.Compact(NewArena(arenaSize))
+	require.Nil(t, err)
+	<-released
+	require.Equal(t, records(list), records(c.Load()))
+
+	// A failed compaction leaves the current skiplist in place.
+	_, released, err = c.Compact(NewArena(4096))
+	require.Equal(t, ErrArenaFull, err)
+	require.Nil(t, released)
+	require.Equal(t, records(list), records(c.Load()))
+}
+
+// TestCompactKeepsOptions tests that the copy is constructed with the options
+// of the original skiplist.
+func TestCompactKeepsOptions(t *testing.T) {
+	collector := epoch.NewCollector()
+	l := NewSkiplist(NewArena(arenaSize), WithComparer(reverse), WithReclamation(collector))
+	var it Iterator
+	it.Init(l)
+	for i := 0; i < 10; i++ {
+		require.Nil(t, it.Add(newValue(i), newValue(i), 0))
+	}
+	it.Close()
+
+	c, _, err := l.CompactInto(NewArena(arenaSize))
+	require.Nil(t, err)
+	require.Equal(t, collector, c.collector)
+	require.Equal(t, records(l), records(c))
+	require.Equal(t, "00009=00009", records(c)[0])
+
+	it.Init(c)
+	require.True(t, it.Seek(newValue(3)))
+	require.Nil(t, it.Delete())
+	it.Close()
+	require.Len(t, records(c), 9)
+}
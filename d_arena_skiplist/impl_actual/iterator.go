@@ -18,9 +18,11 @@
 package arenaskl
 
 import (
+	"iter"
 	"runtime"
 	"sync/atomic"
-	"unsafe"
+
+	"skiplist/epoch"
 )
 
 type splice struct {
@@ -37,18 +39,35 @@ func (s *splice) init(prev, next *node) {
 // skiplist with the iterator. The current state of the iterator can be cloned
 // by simply value copying the struct. All iterator methods are thread-safe.
 type Iterator struct {
-	list  *Skiplist
-	arena *Arena
-	nd    *node
-	value uint64
+	list     *Skiplist
+	arena    *Arena
+	nd       *node
+	value    uint64
+	snapshot uint64       // for versioned skiplists
+	guard    *epoch.Guard // for skiplists with reclamation
+
+	// Set for the iterators of a MergingIterator, which must see tombstones
+	// in versioned skiplists too.
+	tombstones bool
 }
 
-// Init associates the iterator with a skiplist and resets all state.
+// Init associates the iterator with a skiplist and resets all state. If the
+// skiplist has reclamation enabled, the iterator holds a pinned guard until
+// it is closed or initialized again.
 func (it *Iterator) Init(list *Skiplist) {
+	if it.guard != nil {
+		it.guard.Unpin()
+		it.guard = nil
+	}
 	it.list = list
 	it.arena = list.arena
 	it.nd = nil
 	it.value = 0
+	it.snapshot = maxSeqNum
+	it.tombstones = false
+	if list.collector != nil {
+		it.guard = list.collector.Pin()
+	}
 }
 
 // Valid returns true iff the iterator is positioned at a valid node.
@@ -56,13 +75,15 @@ func (it *Iterator) Valid() bool { return it.nd != nil }
 
 // Key returns the key at the current position.
 func (it *Iterator) Key() []byte {
+	if it.list.versioned {
+		return userKey(it.nd.getKey(it.arena))
+	}
 	return it.nd.getKey(it.arena)
 }
 
 // Value returns the value at the current position.
 func (it *Iterator) Value() []byte {
-	valOffset, valSize := decodeValue(it.value)
-	return it.arena.GetBytes(valOffset, uint32(valSize))
+	return it.list.valueBytes(it.value)
 }
 
 // Meta returns the metadata at the current position.
@@ -70,9 +91,23 @@ func (it *Iterator) Meta() uint16 {
 	return decodeMeta(it.value)
 }
 
+// Tombstone reports whether the record at the current position is a tombstone
+// added by MemtableSet.Delete, which has an empty value. An iterator of a
+// versioned skiplist skips tombstones, unless it is part of a MergingIterator.
+func (it *Iterator) Tombstone() bool {
+	if it.list.versioned {
+		return trailer(it.nd.getKey(it.arena))&0xff == kindTombstone
+	}
+	return it.value == it.list.tombstone()
+}
+
 // Next advances to the next position. If there are no following nodes, then
 // Valid() will be false after this call.
 func (it *Iterator) Next() {
+	if it.list.versioned {
+		it.setVersion(it.skipVersions(it.nd, false), false)
+		return
+	}
 	next := it.list.getNext(it.nd, 0)
 	it.setNode(next, false)
 }
@@ -80,7 +115,11 @@ func (it *Iterator) Next() {
 // Prev moves to the previous position. If there are no previous nodes, then
 // Valid() will be false after this call.
 func (it *Iterator) Prev() {
-	prev := it.list.getPrev(it.nd, 0)
+	if it.list.versioned {
+		it.setVersion(it.skipVersions(it.nd, true), true)
+		return
+	}
+	prev := it.list.stepBack(it.nd)
 	it.setNode(prev, true)
 }
 
@@ -89,6 +128,12 @@ func (it *Iterator) Prev() {
 // If the record is not present, then Seek positions the iterator on the
 // following node (if it exists) and returns false.
 func (it *Iterator) Seek(key []byte) (found bool) {
+	if it.list.versioned {
+		_, next, _ := it.seekForBaseSplice(seekKey(key, it.snapshot))
+		it.setVersion(next, false)
+		return it.Valid() && it.list.cmp(it.Key(), key) == 0
+	}
+
 	var next *node
 	_, next, found = it.seekForBaseSplice(key)
 	present := it.setNode(next, false)
@@ -100,6 +145,11 @@ func (it *Iterator) Seek(key []byte) (found bool) {
 // returns true. If the record is not present, then SeekForPrev positions the
 // iterator on the preceding node (if it exists) and returns false.
 func (it *Iterator) SeekForPrev(key []byte) (found bool) {
+	if it.list.versioned {
+		prev, _, _ := it.seekForBaseSplice(seekKey(key, 0))
+		it.setVersion(prev, true)
+		return it.Valid() && it.list.cmp(it.Key(), key) == 0
+	}
 	var prev, next *node
 	prev, next, found = it.seekForBaseSplice(key)
 
@@ -117,11 +167,29 @@ func (it *Iterator) SeekForPrev(key []byte) (found bool) {
 // iterator on it. If the record already exists, then Add positions the iterator
 // on the most current value and returns ErrRecordExists. If there isn't enough
 // room in the arena, then Add returns ErrArenaFull.
+//
+// In a versioned skiplist, Add always adds a new version of the record.
 func (it *Iterator) Add(key []byte, val []byte, meta uint16) error {
+	if it.list.versioned {
+		return it.addVersion(key, val, meta, kindValue)
+	}
+	return it.add(key, val, meta, kindValue)
+}
+
+// add adds a record of the given kind, which is either a value or a tombstone.
+func (it *Iterator) add(key []byte, val []byte, meta uint16, kind uint64) error {
+	for {
+		if err := it.tryAdd(key, val, meta, kind); err != errRetry {
+			return err
+		}
+	}
+}
+
+func (it *Iterator) tryAdd(key []byte, val []byte, meta uint16, kind uint64) error {
 	var spl [maxHeight]splice
 	if it.seekForSplice(key, &spl) {
 		// Found a matching node, but handle case where it's been deleted.
-		return it.setValueIfDeleted(spl[0].next, val, meta)
+		return it.setValueIfDeleted(spl[0].next, val, meta, kind)
 	}
 
 	if it.list.testing {
@@ -131,18 +199,20 @@ func (it *Iterator) Add(key []byte, val []byte, meta uint16) error {
 		runtime.Gosched()
 	}
 
-	nd, height, err := it.list.newNode(key, val, meta)
+	nd, height, err := it.list.newNode(key, val, meta, kind)
 	if err != nil {
 		return err
 	}
 
 	value := nd.value
-	ndOffset := it.arena.GetPointerOffset(unsafe.Pointer(nd))
+	arena := it.arena
+	ndOffset := nd.getOffset(arena)
 
 	// We always insert from the base level and up. After you add a node in base
 	// level, we cannot create a node in the level above because it would have
 	// discovered the node in the base level.
 	var found bool
+levels:
 	for i := 0; i < int(height); i++ {
 		prev := spl[i].prev
 		next := spl[i].next
@@ -170,31 +240,55 @@ func (it *Iterator) Add(key []byte, val []byte, meta uint16) error {
 		// 2. CAS prevNextOffset to repoint from next to nd.
 		// 3. CAS nextPrevOffset to repoint from prev to nd.
 		for {
-			prevOffset := it.arena.GetPointerOffset(unsafe.Pointer(prev))
-			nextOffset := it.arena.GetPointerOffset(unsafe.Pointer(next))
-			nd.tower[i].init(prevOffset, nextOffset)
+			prevOffset := prev.getOffset(arena)
+			nextOffset := next.getOffset(arena)
+			if it.list.collector != nil {
+				// Once nd is linked at level 0, a deleter may mark this
+				// level, in which case it must not be linked.
+				raw := nd.nextOffset(arena, i)
+				if raw&marked != 0 {
+					break levels
+				}
+				nd.storePrevOffset(arena, i, prevOffset)
+				if !nd.casNextOffset(arena, i, raw, nextOffset) {
+					break levels
+				}
+			} else {
+				nd.setPrevOffset(arena, i, prevOffset)
+				nd.setNextOffset(arena, i, nextOffset)
+			}
+
+			// At level 0 with reclamation, a prev offset may only be pointed
+			// at a node while holding a reference to it. A prev without any
+			// left is deleted, so the CAS of its next offset below fails.
+			held := i == 0 && it.list.collector != nil && prev.tryRef(arena)
+			canLink := held || i != 0 || it.list.collector == nil
 
 			// Check whether next has the latest link to prev. If it does not,
 			// that can mean one of two things:
 			//   1. The thread that added the next node hasn't yet had a chance
 			//      to add the prev link (but will shortly).
 			//   2. Another thread has added a new node between prev and next.
-			nextPrevOffset := next.prevOffset(i)
+			nextPrevOffset := next.prevOffset(arena, i)
 			if nextPrevOffset != prevOffset {
 				// Determine whether #1 or #2 is true by checking whether prev
 				// is still pointing to next. As long as the atomic operations
 				// have at least acquire/release semantics (no need for
 				// sequential consistency), this works, as it is equivalent to
 				// the "publication safety" pattern.
-				prevNextOffset := prev.nextOffset(i)
-				if prevNextOffset == nextOffset {
+				prevNextOffset := prev.nextOffset(arena, i)
+				if prevNextOffset == nextOffset && canLink {
 					// Ok, case #1 is true, so help the other thread along by
 					// updating the next node's prev link.
-					next.casPrevOffset(i, nextPrevOffset, prevOffset)
+					it.casPrev(next, i, nextPrevOffset, prev)
 				}
 			}
 
-			if prev.casNextOffset(i, nextOffset, ndOffset) {
+			linked := prev.casNextOffset(arena, i, nextOffset, ndOffset)
+			if held {
+				it.list.release(it.guard, prev)
+			}
+			if linked {
 				// Managed to insert nd between prev and next, so update the next
 				// node's prev link and go to the next level.
 				if it.list.testing {
@@ -204,7 +298,7 @@ func (it *Iterator) Add(key []byte, val []byte, meta uint16) error {
 					runtime.Gosched()
 				}
 
-				next.casPrevOffset(i, prevOffset, ndOffset)
+				it.casPrev(next, i, prevOffset, nd)
 				break
 			}
 
@@ -215,14 +309,24 @@ func (it *Iterator) Add(key []byte, val []byte, meta uint16) error {
 			prev, next, found = it.list.findSpliceForLevel(key, i, prev)
 			if found {
 				if i != 0 {
+					if it.list.collector != nil {
+						// Possible once nd is deleted and unlinked.
+						break levels
+					}
 					panic("how can another thread have inserted a node at a non-base level?")
 				}
 
-				return it.setValueIfDeleted(next, val, meta)
+				if it.list.collector != nil {
+					it.list.discard(nd)
+				}
+				return it.setValueIfDeleted(next, val, meta, kind)
 			}
 		}
 	}
 
+	if it.list.collector != nil {
+		it.list.release(it.guard, nd)
+	}
 	it.value = value
 	it.nd = nd
 	return nil
@@ -235,6 +339,9 @@ func (it *Iterator) Add(key []byte, val []byte, meta uint16) error {
 // the iterator positioned on the current record with the current value and
 // returns ErrRecordDeleted.
 func (it *Iterator) Set(val []byte, meta uint16) error {
+	if it.list.versioned {
+		return ErrRecordVersioned
+	}
 	new, err := it.list.allocVal(val, meta)
 	if err != nil {
 		return err
@@ -250,14 +357,15 @@ func (it *Iterator) Set(val []byte, meta uint16) error {
 // keeps the iterator positioned on the current record with the current value
 // and returns ErrRecordDeleted.
 func (it *Iterator) SetMeta(meta uint16) error {
+	if it.list.versioned {
+		return ErrRecordVersioned
+	}
 	// Try to reuse the same value bytes. Do this only in the case where meta
 	// is increasing, in order to avoid cases where the meta is changed, then
 	// changed back to the original value, which would make it impossible to
 	// detect updates had occurred in the interim.
 	if meta > decodeMeta(it.value) {
-		valOffset, valSize := decodeValue(it.value)
-		new := encodeValue(valOffset, valSize, meta)
-		return it.trySetValue(new)
+		return it.trySetValue(withMeta(it.value, meta))
 	}
 
 	return it.Set(it.Value(), meta)
@@ -269,6 +377,9 @@ func (it *Iterator) SetMeta(meta uint16) error {
 // and returns ErrRecordUpdated. If the record is deleted, then Delete positions
 // the iterator on the next record.
 func (it *Iterator) Delete() error {
+	if it.list.versioned {
+		return ErrRecordVersioned
+	}
 	if !atomic.CompareAndSwapUint64(&it.nd.value, it.value, deletedVal) {
 		if it.setNode(it.nd, false) {
 			return ErrRecordUpdated
@@ -277,6 +388,13 @@ func (it *Iterator) Delete() error {
 		return nil
 	}
 
+	if s := it.list; s.collector != nil {
+		s.retireValue(it.guard, it.value)
+		s.mark(it.nd)
+		s.snip(it.nd.getKey(it.arena))
+		s.release(it.guard, it.nd)
+	}
+
 	// Deletion succeeded, so position iterator on next non-deleted node.
 	next := it.list.getNext(it.nd, 0)
 	it.setNode(next, false)
@@ -286,15 +404,73 @@ func (it *Iterator) Delete() error {
 // SeekToFirst seeks position at the first entry in list.
 // Final state of iterator is Valid() iff list is not empty.
 func (it *Iterator) SeekToFirst() {
+	if it.list.versioned {
+		it.setVersion(it.list.getNext(it.list.head, 0), false)
+		return
+	}
 	it.setNode(it.list.getNext(it.list.head, 0), false)
 }
 
 // SeekToLast seeks position at the last entry in list.
 // Final state of iterator is Valid() iff list is not empty.
 func (it *Iterator) SeekToLast() {
+	if it.list.versioned {
+		it.setVersion(it.list.getPrev(it.list.tail, 0), true)
+		return
+	}
 	it.setNode(it.list.getPrev(it.list.tail, 0), true)
 }
 
+// All returns an iterator over the key/value pairs of the list in ascending
+// key order. Like Iterator, it skips deleted records and sees concurrent
+// changes or not depending on where they land relative to the walk. The
+// slices it yields point into the arena and must not be modified.
+func (s *Skiplist) All() iter.Seq2[[]byte, []byte] {
+	return func(yield func(key, val []byte) bool) {
+		var it Iterator
+		it.Init(s)
+		defer it.Close()
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// Backward is All in descending key order.
+func (s *Skiplist) Backward() iter.Seq2[[]byte, []byte] {
+	return func(yield func(key, val []byte) bool) {
+		var it Iterator
+		it.Init(s)
+		defer it.Close()
+		for it.SeekToLast(); it.Valid(); it.Prev() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// RangeSeq is All restricted to the keys in [lo, hi). A nil hi means no upper
+// bound.
+func (s *Skiplist) RangeSeq(lo, hi []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func(key, val []byte) bool) {
+		var it Iterator
+		it.Init(s)
+		defer it.Close()
+		for it.Seek(lo); it.Valid(); it.Next() {
+			key := it.Key()
+			if hi != nil && s.cmp(key, hi) >= 0 {
+				return
+			}
+			if !yield(key, it.Value()) {
+				return
+			}
+		}
+	}
+}
+
 func (it *Iterator) setNode(nd *node, reverse bool) bool {
 	var value uint64
 
@@ -309,7 +485,7 @@ func (it *Iterator) setNode(nd *node, reverse bool) bool {
 		success = false
 
 		if reverse {
-			nd = it.list.getPrev(nd, 0)
+			nd = it.list.stepBack(nd)
 		} else {
 			nd = it.list.getNext(nd, 0)
 		}
@@ -320,6 +496,17 @@ func (it *Iterator) setNode(nd *node, reverse bool) bool {
 	return success
 }
 
+// casPrev points the prev offset of nd at level h at prev, if it is still old.
+// At level 0 of a skiplist with reclamation, the caller holds a reference to
+// prev, and linkPrev makes sure that the offset ends up right.
+func (it *Iterator) casPrev(nd *node, h int, old uint64, prev *node) {
+	if h == 0 && it.list.collector != nil {
+		it.list.linkPrev(it.guard, nd, old, prev)
+		return
+	}
+	nd.casPrevOffset(it.arena, h, old, prev.getOffset(it.arena))
+}
+
 func (it *Iterator) trySetValue(new uint64) error {
 	if !atomic.CompareAndSwapUint64(&it.nd.value, it.value, new) {
 		old := atomic.LoadUint64(&it.nd.value)
@@ -331,11 +518,14 @@ func (it *Iterator) trySetValue(new uint64) error {
 		return ErrRecordUpdated
 	}
 
+	if it.list.collector != nil && new&valueLocationMask != it.value&valueLocationMask {
+		it.list.retireValue(it.guard, it.value)
+	}
 	it.value = new
 	return nil
 }
 
-func (it *Iterator) setValueIfDeleted(nd *node, val []byte, meta uint16) error {
+func (it *Iterator) setValueIfDeleted(nd *node, val []byte, meta uint16, kind uint64) error {
 	var newValOffsetSz uint64
 	var err error
 
@@ -349,9 +539,17 @@ func (it *Iterator) setValueIfDeleted(nd *node, val []byte, meta uint16) error {
 			return ErrRecordExists
 		}
 
+		if it.list.collector != nil {
+			// A deleted node is on its way out, and cannot come back. Help
+			// it out and add a new one.
+			it.list.mark(nd)
+			it.list.snip(nd.getKey(it.arena))
+			return errRetry
+		}
+
 		// allocate new value only once in the Arena
 		if newValOffsetSz == 0 {
-			newValOffsetSz, err = it.list.allocVal(val, meta)
+			newValOffsetSz, err = it.list.newValue(val, meta, kind)
 			if err != nil {
 				return err
 			}
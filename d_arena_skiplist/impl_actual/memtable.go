@@ -0,0 +1,405 @@
+package arenaskl
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"skiplist/internal/backoff"
+)
+
+// Memtable is one of the skiplists of a MemtableSet, along with a count of
+// the references to it. The set holds one reference for as long as the
+// memtable is part of it. Once the last one is dropped, the arena of the
+// memtable is reset and reused by a later one.
+//
+// Writers also count themselves in writers while they add to the memtable,
+// the way Pebble counts writerRefs, so that it is not flushed before a write
+// that started while it was mutable has landed.
+type Memtable struct {
+	set     *MemtableSet
+	list    *Skiplist
+	refs    int32
+	writers int32
+}
+
+// Skiplist returns the skiplist of the memtable. It must only be used while
+// holding a reference to the memtable.
+func (mt *Memtable) Skiplist() *Skiplist { return mt.list }
+
+// tryRef takes a reference to the memtable unless it is already released.
+func (mt *Memtable) tryRef() bool {
+	for {
+		refs := atomic.LoadInt32(&mt.refs)
+		if refs == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&mt.refs, refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// Unref drops a reference to the memtable.
+func (mt *Memtable) Unref() {
+	switch refs := atomic.AddInt32(&mt.refs, -1); {
+	case refs == 0:
+		mt.set.recycle(mt.list.Arena())
+	case refs < 0:
+		panic("memtable released too many times")
+	}
+}
+
+// MemtableSet fills one mutable skiplist at a time. When its arena is full,
+// the set freezes it, keeping it around as an immutable skiplist until it is
+// flushed, and carries on with a new one, the way Pebble rotates memtables.
+//
+// Writers never lock unless they need to rotate. A writer that rotates while
+// the set already holds the maximum number of immutable memtables waits for
+// one of them to be flushed.
+type MemtableSet struct {
+	arenaSize    uint32
+	maxImmutable int
+	opts         []Option
+	room         uint32 // free bytes in the arena of a new memtable
+	rotateAt     uint64 // arena size at which a write rotates its memtable
+
+	mutable atomic.Pointer[Memtable]
+
+	mu        sync.Mutex
+	flushed   *sync.Cond
+	immutable []*Memtable // oldest first
+	arenas    []*Arena    // reset arenas, for new memtables
+}
+
+// rotateSlack is the fraction of its room, as 1/rotateSlack, that may be left
+// in the arena of a memtable before a write rotates it. Filling arenas to the
+// last byte would make the writers that do not fit retry on a new memtable.
+const rotateSlack = 16
+
+// NewMemtableSet returns a set of memtables with arenas of arenaSize bytes,
+// at most maxImmutable of which are waiting to be flushed at any time. The
+// skiplists are made with opts.
+func NewMemtableSet(arenaSize uint32, maxImmutable int, opts ...Option) *MemtableSet {
+	if maxImmutable < 1 {
+		panic("maxImmutable must be at least one")
+	}
+
+	m := &MemtableSet{
+		arenaSize:    arenaSize,
+		maxImmutable: maxImmutable,
+		opts:         opts,
+	}
+	m.flushed = sync.NewCond(&m.mu)
+	mt := m.newMemtable()
+	m.room = arenaSize - uint32(mt.list.Size())
+	m.rotateAt = uint64(arenaSize) - uint64(m.room)/rotateSlack
+	m.mutable.Store(mt)
+	return m
+}
+
+// Add adds a record to the mutable memtable, as Iterator.Add does, rotating
+// memtables as needed. Only the mutable memtable is checked for an existing
+// record, so that a record in it hides records with the same key in the
+// immutable ones. A tombstone left by Delete does not count as a record, and
+// is replaced. Add returns ErrArenaFull only if the record would not fit even
+// in an empty arena.
+func (m *MemtableSet) Add(key, val []byte, meta uint16) error {
+	return m.write(key, val, meta, kindValue)
+}
+
+// Delete adds a tombstone for key to the mutable memtable, rotating memtables
+// as needed, which hides the records with key in the immutable memtables from
+// a MergingIterator. A record with key in the mutable memtable is replaced by
+// the tombstone. Deleting the record there with Iterator.Delete instead would
+// bring back the older ones.
+func (m *MemtableSet) Delete(key []byte) error {
+	return m.write(key, nil, 0, kindTombstone)
+}
+
+// write adds a record of the given kind to the mutable memtable. The writer
+// that fills the arena beyond rotateAt rotates the memtable.
+func (m *MemtableSet) write(key, val []byte, meta uint16, kind uint64) error {
+	// An upper bound on what a node takes, with its state and alignment.
+	if need := uint64(MaxNodeSize+statePrefix) + uint64(len(key)) + trailerLen + uint64(len(val)) + Align8; need > uint64(m.room) {
+		return ErrArenaFull
+	}
+
+	for {
+		mt := m.acquireWriter()
+		var it Iterator
+		it.Init(mt.list)
+		err := it.put(key, val, meta, kind)
+		it.Close()
+		full := err == ErrArenaFull || mt.list.Size() >= m.rotateAt
+		mt.releaseWriter()
+		if full {
+			m.rotate(mt)
+		}
+		if err != ErrArenaFull {
+			return err
+		}
+	}
+}
+
+// put adds a record of the given kind for MemtableSet.write. A tombstone
+// replaces any record with key, and a value replaces a tombstone.
+func (it *Iterator) put(key, val []byte, meta uint16, kind uint64) error {
+	if it.list.versioned {
+		return it.addVersion(key, val, meta, kind)
+	}
+
+	// The value for trySetValue is allocated once and kept for the retries.
+	// It is freed if it ends up unused.
+	var new uint64
+	for {
+		err := it.add(key, val, meta, kind)
+		if err == ErrRecordExists {
+			switch {
+			case kind == kindTombstone && it.Tombstone():
+				err = nil
+			case kind == kindValue && !it.Tombstone():
+			default:
+				if new == 0 {
+					if new, err = it.list.newValue(val, meta, kind); err != nil {
+						return err
+					}
+				}
+				if it.trySetValue(new) == nil {
+					return nil
+				}
+				// Updated or deleted meanwhile, so start over.
+				continue
+			}
+		}
+		it.list.freeValue(new)
+		return err
+	}
+}
+
+// Rotate freezes the mutable memtable, as if it were full. Add and Delete
+// rotate on their own once the arena is nearly full; Rotate lets callers
+// freeze the records so far at any other time, for example before a flush.
+func (m *MemtableSet) Rotate() {
+	mt := m.acquireMutable()
+	defer mt.Unref()
+	m.rotate(mt)
+}
+
+// Mutable returns the mutable memtable with a reference taken on it.
+func (m *MemtableSet) Mutable() *Memtable {
+	return m.acquireMutable()
+}
+
+// Oldest returns the oldest immutable memtable with a reference taken on it,
+// or nil if there is none. Once it is flushed, pass it to Flushed. Oldest
+// waits for the writers that took the memtable while it was still mutable
+// to finish, so that the flush sees all of their records.
+func (m *MemtableSet) Oldest() *Memtable {
+	m.mu.Lock()
+	if len(m.immutable) == 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	mt := m.immutable[0]
+	atomic.AddInt32(&mt.refs, 1)
+	m.mu.Unlock()
+
+	// No writer can join once the memtable is frozen, so this is short.
+	var b backoff.Backoff
+	for atomic.LoadInt32(&mt.writers) != 0 {
+		b.Wait()
+	}
+	return mt
+}
+
+// Flushed removes mt, which must be the oldest immutable memtable, from the
+// set. Its arena is reused once every reader is done with it.
+func (m *MemtableSet) Flushed(mt *Memtable) {
+	m.mu.Lock()
+	if len(m.immutable) == 0 || m.immutable[0] != mt {
+		m.mu.Unlock()
+		panic("only the oldest immutable memtable can be flushed")
+	}
+	m.immutable[0] = nil
+	m.immutable = m.immutable[1:]
+	m.flushed.Broadcast()
+	m.mu.Unlock()
+
+	mt.Unref()
+}
+
+// NewIterator returns a merged iterator over the mutable memtable and all
+// the immutable ones. It holds a reference to every one of them until it is
+// closed.
+func (m *MemtableSet) NewIterator() *MergingIterator {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The mutable memtable only changes under mu.
+	tables := []*Memtable{m.mutable.Load()}
+	for i := len(m.immutable) - 1; i >= 0; i-- {
+		tables = append(tables, m.immutable[i])
+	}
+
+	it := &MergingIterator{tables: tables, iters: make([]Iterator, len(tables)), cur: -1}
+	for i, mt := range tables {
+		atomic.AddInt32(&mt.refs, 1)
+		it.iters[i].Init(mt.list)
+		it.iters[i].tombstones = true
+	}
+	it.cmp = tables[0].list.cmp
+	return it
+}
+
+// acquireMutable returns the mutable memtable with a reference taken on it.
+func (m *MemtableSet) acquireMutable() *Memtable {
+	for {
+		// The memtable may be rotated out and released after it is loaded,
+		// in which case tryRef fails and the new one is loaded.
+		if mt := m.mutable.Load(); mt.tryRef() {
+			return mt
+		}
+	}
+}
+
+// acquireWriter returns the mutable memtable with a reference taken on it,
+// counted among its writers until releaseWriter.
+func (m *MemtableSet) acquireWriter() *Memtable {
+	for {
+		mt := m.acquireMutable()
+		atomic.AddInt32(&mt.writers, 1)
+		// A memtable is frozen before Oldest can return it, so a writer that
+		// still finds it mutable here is one that Oldest waits for.
+		if m.mutable.Load() == mt {
+			return mt
+		}
+		mt.releaseWriter()
+	}
+}
+
+// releaseWriter drops the writer count and the reference that acquireWriter
+// took.
+func (mt *Memtable) releaseWriter() {
+	atomic.AddInt32(&mt.writers, -1)
+	mt.Unref()
+}
+
+// rotate freezes full unless another writer already has.
+func (m *MemtableSet) rotate(full *Memtable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.mutable.Load() == full {
+		if len(m.immutable) < m.maxImmutable {
+			m.immutable = append(m.immutable, full)
+			m.mutable.Store(m.newMemtable())
+			return
+		}
+		m.flushed.Wait()
+	}
+}
+
+// newMemtable must be called with mu held.
+func (m *MemtableSet) newMemtable() *Memtable {
+	var arena *Arena
+	if n := len(m.arenas); n > 0 {
+		arena, m.arenas = m.arenas[n-1], m.arenas[:n-1]
+	} else {
+		arena = NewArena(m.arenaSize)
+	}
+	return &Memtable{set: m, list: NewSkiplist(arena, m.opts...), refs: 1}
+}
+
+func (m *MemtableSet) recycle(arena *Arena) {
+	arena.Reset()
+	m.mu.Lock()
+	m.arenas = append(m.arenas, arena)
+	m.mu.Unlock()
+}
+
+// MergingIterator iterates over the records of several memtables in key
+// order. Where memtables hold records with the same key, it shows the one in
+// the newest memtable, or none if that is a tombstone left by
+// MemtableSet.Delete.
+type MergingIterator struct {
+	tables []*Memtable
+	iters  []Iterator // newest first
+	cmp    Comparer
+	cur    int // index of the iterator at the current record, or -1
+}
+
+// Valid returns true iff the iterator is positioned at a valid record.
+func (it *MergingIterator) Valid() bool { return it.cur >= 0 }
+
+// Key returns the key at the current position.
+func (it *MergingIterator) Key() []byte { return it.iters[it.cur].Key() }
+
+// Value returns the value at the current position.
+func (it *MergingIterator) Value() []byte { return it.iters[it.cur].Value() }
+
+// Meta returns the metadata at the current position.
+func (it *MergingIterator) Meta() uint16 { return it.iters[it.cur].Meta() }
+
+// SeekToFirst seeks position at the first record of any memtable.
+func (it *MergingIterator) SeekToFirst() {
+	for i := range it.iters {
+		it.iters[i].SeekToFirst()
+	}
+	it.findMin()
+}
+
+// Seek positions the iterator on the first record with a key >= key and
+// reports whether its key equals key.
+func (it *MergingIterator) Seek(key []byte) (found bool) {
+	for i := range it.iters {
+		it.iters[i].Seek(key)
+	}
+	it.findMin()
+	return it.Valid() && it.cmp(it.Key(), key) == 0
+}
+
+// Next advances to the next key, past the records with the current key in
+// every memtable.
+func (it *MergingIterator) Next() {
+	it.skip()
+	it.findMin()
+}
+
+// skip moves every iterator at the current key past it.
+func (it *MergingIterator) skip() {
+	key := it.Key()
+	for i := range it.iters {
+		if it.iters[i].Valid() && it.cmp(it.iters[i].Key(), key) == 0 {
+			it.iters[i].Next()
+		}
+	}
+}
+
+// Close drops the references of the iterator to its memtables. The iterator
+// must not be used afterwards.
+func (it *MergingIterator) Close() {
+	for i, mt := range it.tables {
+		it.iters[i].Close()
+		mt.Unref()
+	}
+	it.tables, it.iters, it.cur = nil, nil, -1
+}
+
+// findMin positions the iterator on the smallest key of any memtable whose
+// newest record is not a tombstone.
+func (it *MergingIterator) findMin() {
+	for {
+		it.cur = -1
+		for i := range it.iters {
+			if !it.iters[i].Valid() {
+				continue
+			}
+			if it.cur < 0 || it.cmp(it.iters[i].Key(), it.Key()) < 0 {
+				it.cur = i
+			}
+		}
+		if it.cur < 0 || !it.iters[it.cur].Tombstone() {
+			return
+		}
+		it.skip()
+	}
+}
@@ -0,0 +1,288 @@
+package arenaskl
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"skiplist/epoch"
+
+	"github.com/stretchr/testify/require"
+)
+
+// merged returns the key=value pairs the merged iterator of m sees.
+func merged(m *MemtableSet) []string {
+	it := m.NewIterator()
+	defer it.Close()
+	var out []string
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		out = append(out, string(it.Key())+"="+string(it.Value()))
+	}
+	return out
+}
+
+// TestMemtableRotation tests that a full memtable is frozen and that the
+// merged iterator sees all memtables, the newest ones first.
+func TestMemtableRotation(t *testing.T) {
+	const n = 200
+	m := NewMemtableSet(4096, 100)
+
+	for i := 0; i < n; i++ {
+		require.Nil(t, m.Add([]byte(fmt.Sprintf("%05d", i)), newValue(i), 0))
+	}
+	// A fresh memtable is far from full, so the second Add sees the first.
+	m.Rotate()
+	require.Nil(t, m.Add([]byte("00001"), []byte("new"), 0))
+	require.Equal(t, ErrRecordExists, m.Add([]byte("00001"), newValue(0), 0))
+
+	all := merged(m)
+	require.Len(t, all, n)
+	require.Equal(t, "00000=00000", all[0])
+	require.Equal(t, "00001=new", all[1])
+	require.Equal(t, "00199=00199", all[n-1])
+
+	it := m.NewIterator()
+	require.True(t, it.Seek([]byte("00150")))
+	require.EqualValues(t, newValue(150), it.Value())
+	require.False(t, it.Seek([]byte("0015")))
+	require.EqualValues(t, "00150", it.Key())
+	it.Close()
+
+	// A record can be larger than what is left of an arena, but not larger
+	// than an empty arena.
+	require.Nil(t, m.Add([]byte("big"), make([]byte, 3000), 0))
+	require.Equal(t, ErrArenaFull, m.Add([]byte("huge"), make([]byte, 4096), 0))
+}
+
+// TestMemtableRotatesNearlyFull tests that a write rotates the memtable once
+// its arena is nearly full, before any write fails to fit.
+func TestMemtableRotatesNearlyFull(t *testing.T) {
+	m := NewMemtableSet(1<<16, 1)
+	var i int
+	for ; len(m.immutable) == 0; i++ {
+		require.Nil(t, m.Add([]byte(fmt.Sprintf("%05d", i)), newValue(i), 0))
+	}
+
+	oldest := m.Oldest()
+	size := oldest.Skiplist().Size()
+	require.GreaterOrEqual(t, size, m.rotateAt)
+	// The last record took a fraction of the slack that was left.
+	require.Less(t, size, m.rotateAt+uint64(m.room)/rotateSlack/4)
+	require.Equal(t, i, length(oldest.Skiplist()))
+	m.Flushed(oldest)
+	oldest.Unref()
+}
+
+// TestMemtableFlush tests that the arena of a flushed memtable is only reset
+// once the last reader is done with it, and is then reused.
+func TestMemtableFlush(t *testing.T) {
+	m := NewMemtableSet(1<<16, 2)
+	require.Nil(t, m.Add([]byte("a"), []byte("1"), 0))
+	m.Rotate()
+	require.Nil(t, m.Add([]byte("b"), []byte("2"), 0))
+
+	it := m.NewIterator()
+	it.SeekToFirst()
+
+	oldest := m.Oldest()
+	arena := oldest.Skiplist().Arena()
+	m.Flushed(oldest)
+	oldest.Unref()
+	require.Nil(t, m.Oldest())
+	require.Equal(t, []string{"b=2"}, merged(m))
+
+	// The iterator still reads the flushed memtable.
+	require.EqualValues(t, "a", it.Key())
+	require.EqualValues(t, "1", it.Value())
+	require.Len(t, m.arenas, 0)
+	it.Close()
+	require.Equal(t, []*Arena{arena}, m.arenas)
+
+	m.Rotate()
+	mt := m.Mutable()
+	require.Equal(t, arena, mt.Skiplist().Arena())
+	mt.Unref()
+	require.Equal(t, []string{"b=2"}, merged(m))
+}
+
+// TestMemtableFlushWaitsForWriters tests that a memtable rotated out from
+// under a writer is not handed out for flushing until the write has landed.
+func TestMemtableFlushWaitsForWriters(t *testing.T) {
+	m := NewMemtableSet(1<<16, 2)
+
+	// The steps of write, with a rotation after the writer took the memtable.
+	mt := m.acquireWriter()
+	m.Rotate()
+
+	oldest := make(chan *Memtable)
+	go func() { oldest <- m.Oldest() }()
+	select {
+	case <-oldest:
+		t.Fatal("Oldest did not wait for the writer")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	var it Iterator
+	it.Init(mt.list)
+	require.Nil(t, it.put([]byte("k"), []byte("v"), 0, kindValue))
+	it.Close()
+	mt.releaseWriter()
+
+	flushed := <-oldest
+	require.Equal(t, mt, flushed)
+	require.Equal(t, []string{"k=v"}, merged(m))
+	it.Init(flushed.Skiplist())
+	require.True(t, it.Seek([]byte("k")))
+	it.Close()
+	m.Flushed(flushed)
+	flushed.Unref()
+
+	// Later writes go to the new mutable memtable.
+	require.Nil(t, m.Add([]byte("k2"), []byte("v"), 0))
+	require.Equal(t, []string{"k2=v"}, merged(m))
+	require.Len(t, m.arenas, 1)
+}
+
+// TestMemtableDelete tests that a key deleted from the mutable memtable is
+// hidden from the merged iterator, even where older memtables hold it.
+func TestMemtableDelete(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithVersions()}} {
+		m := NewMemtableSet(1<<16, 2, opts...)
+		require.Nil(t, m.Add([]byte("a"), []byte("1"), 0))
+		require.Nil(t, m.Add([]byte("b"), []byte("1"), 0))
+		require.Nil(t, m.Add([]byte("c"), []byte("1"), 0))
+		m.Rotate()
+
+		// Only in an immutable memtable.
+		require.Nil(t, m.Delete([]byte("a")))
+		// In both, replacing the record in the mutable one.
+		require.Nil(t, m.Add([]byte("b"), []byte("2"), 0))
+		require.Nil(t, m.Delete([]byte("b")))
+		require.Nil(t, m.Delete([]byte("b")))
+		// Nowhere.
+		require.Nil(t, m.Delete([]byte("d")))
+		require.Equal(t, []string{"c=1"}, merged(m))
+
+		it := m.NewIterator()
+		require.False(t, it.Seek([]byte("a")))
+		require.EqualValues(t, "c", it.Key())
+		it.Close()
+
+		if opts == nil {
+			// A flusher sees the tombstones.
+			mt := m.Mutable()
+			var tombstones []string
+			var mit Iterator
+			mit.Init(mt.Skiplist())
+			for mit.SeekToFirst(); mit.Valid(); mit.Next() {
+				require.True(t, mit.Tombstone())
+				require.Empty(t, mit.Value())
+				tombstones = append(tombstones, string(mit.Key()))
+			}
+			mit.Close()
+			mt.Unref()
+			require.Equal(t, []string{"a", "b", "d"}, tombstones)
+		}
+
+		// Adding a deleted key brings it back.
+		require.Nil(t, m.Add([]byte("a"), []byte("3"), 0))
+		require.Equal(t, []string{"a=3", "c=1"}, merged(m))
+	}
+}
+
+// TestConcurrentMemtables tests writers that keep rotating memtables while
+// a flusher frees them up and readers scan.
+func TestConcurrentMemtables(t *testing.T) {
+	const n = 4000
+	m := NewMemtableSet(8192, 2)
+
+	done := make(chan struct{})
+	var flusher sync.WaitGroup
+	flusher.Add(1)
+	flushed := 0
+	go func() {
+		defer flusher.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			mt := m.Oldest()
+			if mt == nil {
+				runtime.Gosched()
+				continue
+			}
+			var it Iterator
+			it.Init(mt.Skiplist())
+			for it.SeekToFirst(); it.Valid(); it.Next() {
+				flushed++
+			}
+			m.Flushed(mt)
+			mt.Unref()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < n; i += 4 {
+				require.Nil(t, m.Add([]byte(fmt.Sprintf("%05d", i)), newValue(i), 0))
+				if i%500 == 0 {
+					prev := ""
+					for _, kv := range merged(m) {
+						require.Less(t, prev, kv)
+						prev = kv
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(done)
+	flusher.Wait()
+
+	require.Equal(t, n, flushed+len(merged(m)))
+}
+
+// TestMemtableReclamation tests that memtables with reclamation reuse arenas
+// safely: space retired by a flushed memtable is never freed into the arena
+// after it is reset for a new one.
+func TestMemtableReclamation(t *testing.T) {
+	m := NewMemtableSet(1<<16, 1, WithReclamation(epoch.NewCollector()))
+
+	for round := 0; round < 50; round++ {
+		mt := m.Mutable()
+		var it Iterator
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("%05d", i))
+			require.Nil(t, m.Add(key, newValue(round), 0))
+			if i%4 != 0 {
+				it.Init(mt.Skiplist())
+				require.True(t, it.Seek(key))
+				require.Nil(t, it.Delete())
+			}
+		}
+		it.Close()
+		mt.Unref()
+
+		require.Len(t, merged(m), 25)
+		m.Rotate()
+		oldest := m.Oldest()
+		m.Flushed(oldest)
+		oldest.Unref()
+	}
+
+	for i := 0; i < 100; i++ {
+		require.Nil(t, m.Add([]byte(fmt.Sprintf("%05d", i)), []byte("last"), 0))
+	}
+	all := merged(m)
+	require.Len(t, all, 100)
+	for i, kv := range all {
+		require.Equal(t, fmt.Sprintf("%05d=last", i), kv)
+	}
+}
@@ -19,6 +19,7 @@ package arenaskl
 
 import (
 	"sync/atomic"
+	"unsafe"
 )
 
 type links struct {
@@ -26,9 +27,10 @@ type links struct {
 	prevOffset uint32
 }
 
-func (l *links) init(prevOffset, nextOffset uint32) {
-	l.nextOffset = nextOffset
-	l.prevOffset = prevOffset
+// wideLinks are the links of a node in a chained arena.
+type wideLinks struct {
+	nextOffset uint64
+	prevOffset uint64
 }
 
 type node struct {
@@ -41,6 +43,8 @@ type node struct {
 	//   value offset: uint32 (bits 0-31)
 	//   value size  : uint16 (bits 32-47)
 	//   metadata    : uint16 (bits 48-63)
+	// In a chained arena, the value offset takes bits 0-47 instead, and the
+	// size is stored in front of the value bytes.
 	value uint64
 
 	// Most nodes do not need to use the full height of the tower, since the
@@ -53,40 +57,226 @@ type node struct {
 	tower [maxHeight]links
 }
 
-func newNode(arena *Arena, height uint32) (nd *node, err error) {
+// wideNode is the layout of a node in a chained arena, whose offsets can take
+// more than 32 bits. It starts with the fields of node, of which keyOffset
+// only holds the low half of the key offset, and follows them with the offset
+// of the node itself, the high half of the key offset, the state of the node
+// and a tower of wide links. Only the accessors below tell the two apart, so
+// that plain arenas keep the smaller nodes.
+//
+// Recovering the offset of a node from its pointer takes a scan of the blocks
+// of a chained arena, so a wide node keeps its own.
+type wideNode struct {
+	keyOffset   uint32
+	keySize     uint32
+	value       uint64
+	offset      uint64
+	keyOffsetHi uint32
+	state       uint32
+	tower       [maxHeight]wideLinks
+}
+
+const (
+	maxWideNodeSize = int(unsafe.Sizeof(wideNode{}))
+	wideLinksSize   = int(unsafe.Sizeof(wideLinks{}))
+)
+
+// newNode allocates a node of the given height. A counted node, of a skiplist
+// with reclamation, has a state too.
+func newNode(arena *Arena, height uint32, counted bool) (nd *node, err error) {
 	if height < 1 || height > maxHeight {
 		panic("height cannot be less than one or greater than the max height")
 	}
 
 	// Compute the amount of the tower that will never be used, since the height
 	// is less than maxHeight.
-	unusedSize := (maxHeight - int(height)) * linksSize
+	size, unusedSize := nodeSize(arena, height, counted)
 
-	nodeOffset, err := arena.Alloc(uint32(MaxNodeSize-unusedSize), uint32(unusedSize), Align8)
+	nodeOffset, err := arena.Alloc(size, unusedSize, Align8)
 	if err != nil {
 		return
 	}
+	if counted && !arena.wide() {
+		nodeOffset += statePrefix
+	}
 
 	nd = (*node)(arena.GetPointer(nodeOffset))
+	if counted {
+		*nd.state(arena) = height << heightShift
+	}
+	// The space may be reused, and an unlinked level must read as zero.
+	if arena.wide() {
+		w := nd.wide()
+		w.offset = nodeOffset
+		for i := range w.tower[:height] {
+			w.tower[i] = wideLinks{}
+		}
+		return
+	}
+	for i := range nd.tower[:height] {
+		nd.tower[i] = links{}
+	}
 	return
 }
 
+// nodeSize returns the number of bytes that a node of the given height takes
+// in arena, and the number of bytes of the tower that it leaves out.
+func nodeSize(arena *Arena, height uint32, counted bool) (size, unused uint32) {
+	maxSize, linkSize := MaxNodeSize, linksSize
+	if arena.wide() {
+		maxSize, linkSize = maxWideNodeSize, wideLinksSize
+	} else if counted {
+		maxSize += statePrefix
+	}
+	unused = uint32((maxHeight - int(height)) * linkSize)
+	return uint32(maxSize) - unused, unused
+}
+
+// wide returns the node as laid out in a chained arena.
+func (n *node) wide() *wideNode {
+	return (*wideNode)(unsafe.Pointer(n))
+}
+
+// statePrefix is the space in front of a counted node in a plain arena,
+// which holds its state. A wide node keeps it in what would otherwise be the
+// padding of its header, so no node pays for a state it does not have.
+const statePrefix = 8
+
+// The state of a counted node packs the height of its tower, which gives the
+// size of the node to free, above the count of the references to it.
+const (
+	heightShift = 24
+	refsMask    = 1<<heightShift - 1
+)
+
+// state returns the state of a counted node.
+func (n *node) state(arena *Arena) *uint32 {
+	if arena.wide() {
+		return &n.wide().state
+	}
+	return (*uint32)(unsafe.Add(unsafe.Pointer(n), -statePrefix))
+}
+
+// height returns the height of the tower of a counted node.
+func (n *node) height(arena *Arena) uint32 {
+	return atomic.LoadUint32(n.state(arena)) >> heightShift
+}
+
+// setRefs sets the number of references to a counted node that release
+// drops. It must be called before the node is linked.
+func (n *node) setRefs(arena *Arena, refs uint32) {
+	state := n.state(arena)
+	*state = *state&^refsMask | refs
+}
+
+// tryRef takes another reference to a counted node, unless the last one is
+// already dropped.
+func (n *node) tryRef(arena *Arena) bool {
+	state := n.state(arena)
+	for {
+		old := atomic.LoadUint32(state)
+		if old&refsMask == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(state, old, old+1) {
+			return true
+		}
+	}
+}
+
+// unref drops a reference to a counted node and reports whether it was the
+// last.
+func (n *node) unref(arena *Arena) bool {
+	return atomic.AddUint32(n.state(arena), ^uint32(0))&refsMask == 0
+}
+
+// span returns the part of arena that a counted node takes.
+func (n *node) span(arena *Arena) (offset uint64, size uint32) {
+	offset = n.getOffset(arena)
+	if !arena.wide() {
+		offset -= statePrefix
+	}
+	size, _ = nodeSize(arena, n.height(arena), true)
+	return offset, size
+}
+
+// getOffset returns the offset of the node in arena.
+func (n *node) getOffset(arena *Arena) uint64 {
+	if arena.wide() {
+		return n.wide().offset
+	}
+	return arena.GetPointerOffset(unsafe.Pointer(n))
+}
+
+// getKeyOffset returns the offset of the key of the node in arena.
+func (n *node) getKeyOffset(arena *Arena) uint64 {
+	if arena.wide() {
+		return uint64(n.wide().keyOffsetHi)<<32 | uint64(n.keyOffset)
+	}
+	return uint64(n.keyOffset)
+}
+
+func (n *node) setKeyOffset(arena *Arena, keyOffset uint64) {
+	n.keyOffset = uint32(keyOffset)
+	if arena.wide() {
+		n.wide().keyOffsetHi = uint32(keyOffset >> 32)
+	}
+}
+
 func (n *node) getKey(arena *Arena) []byte {
-	return arena.GetBytes(n.keyOffset, n.keySize)
+	return arena.GetBytes(n.getKeyOffset(arena), n.keySize)
+}
+
+func (n *node) nextOffset(arena *Arena, h int) uint64 {
+	if arena.wide() {
+		return atomic.LoadUint64(&n.wide().tower[h].nextOffset)
+	}
+	return uint64(atomic.LoadUint32(&n.tower[h].nextOffset))
+}
+
+func (n *node) prevOffset(arena *Arena, h int) uint64 {
+	if arena.wide() {
+		return atomic.LoadUint64(&n.wide().tower[h].prevOffset)
+	}
+	return uint64(atomic.LoadUint32(&n.tower[h].prevOffset))
+}
+
+func (n *node) casNextOffset(arena *Arena, h int, old, val uint64) bool {
+	if arena.wide() {
+		return atomic.CompareAndSwapUint64(&n.wide().tower[h].nextOffset, old, val)
+	}
+	return atomic.CompareAndSwapUint32(&n.tower[h].nextOffset, uint32(old), uint32(val))
 }
 
-func (n *node) nextOffset(h int) uint32 {
-	return atomic.LoadUint32(&n.tower[h].nextOffset)
+func (n *node) casPrevOffset(arena *Arena, h int, old, val uint64) bool {
+	if arena.wide() {
+		return atomic.CompareAndSwapUint64(&n.wide().tower[h].prevOffset, old, val)
+	}
+	return atomic.CompareAndSwapUint32(&n.tower[h].prevOffset, uint32(old), uint32(val))
 }
 
-func (n *node) prevOffset(h int) uint32 {
-	return atomic.LoadUint32(&n.tower[h].prevOffset)
+func (n *node) storePrevOffset(arena *Arena, h int, val uint64) {
+	if arena.wide() {
+		atomic.StoreUint64(&n.wide().tower[h].prevOffset, val)
+		return
+	}
+	atomic.StoreUint32(&n.tower[h].prevOffset, uint32(val))
 }
 
-func (n *node) casNextOffset(h int, old, val uint32) bool {
-	return atomic.CompareAndSwapUint32(&n.tower[h].nextOffset, old, val)
+// setNextOffset and setPrevOffset are for nodes that no other goroutine can
+// see yet.
+func (n *node) setNextOffset(arena *Arena, h int, val uint64) {
+	if arena.wide() {
+		n.wide().tower[h].nextOffset = val
+		return
+	}
+	n.tower[h].nextOffset = uint32(val)
 }
 
-func (n *node) casPrevOffset(h int, old, val uint32) bool {
-	return atomic.CompareAndSwapUint32(&n.tower[h].prevOffset, old, val)
+func (n *node) setPrevOffset(arena *Arena, h int, val uint64) {
+	if arena.wide() {
+		n.wide().tower[h].prevOffset = val
+		return
+	}
+	n.tower[h].prevOffset = uint32(val)
 }
@@ -0,0 +1,253 @@
+package arenaskl
+
+import (
+	"errors"
+
+	"skiplist/epoch"
+)
+
+// A skiplist with reclamation, enabled by WithReclamation, physically
+// removes deleted nodes and frees their space in the arena for reuse. It
+// follows Harris and Fraser: a deleted node first has the next offsets of
+// its tower marked, top down, so that nothing can be linked after it any
+// more, and is then unlinked by searches, which remove every marked node
+// they come across. Node offsets are multiples of 8, so the low bit of a
+// next offset is free to serve as the mark.
+//
+// Only level 0 prev offsets are ever followed, by iterators walking in
+// reverse. Each node counts the references to it: one of its inserter, one
+// of its deleter, and one of every goroutine that is about to point a prev
+// offset at it. Whoever points a prev offset at a node then checks that the
+// node still links to it, and corrects the offset if not, before dropping
+// the reference; the last reference corrects the offset of the node that
+// followed it. So the prev offset of a node that is not deleted always points
+// at a node that is not freed yet, and reverse iteration stays O(1).
+//
+// A deleted node is freed once both its inserter and its deleter are done
+// with it, and once no pinned guard of the collector can still reach it.
+// Iterators hold a guard from Init to Close.
+const marked = 1
+
+// errRetry tells Add to start over.
+var errRetry = errors.New("retry")
+
+// WithReclamation makes the skiplist unlink deleted nodes and free their
+// space, and that of replaced values, through guards of c. Iterators of
+// such a skiplist must be closed, and must not be copied.
+func WithReclamation(c *epoch.Collector) Option {
+	return func(s *Skiplist) { s.collector = c }
+}
+
+// Close releases the guard the iterator holds if the skiplist has
+// reclamation enabled. The iterator must not be used afterwards, unless it
+// is initialized again.
+func (it *Iterator) Close() {
+	if it.guard != nil {
+		it.guard.Unpin()
+		it.guard = nil
+	}
+	it.nd = nil
+}
+
+// span is a part of the arena to be freed, as of a generation of the arena.
+// It is dropped instead if the arena is reset before it can be freed, since
+// by then it may be part of a new skiplist.
+type span struct {
+	gen    uint64
+	offset uint64
+	size   uint32
+}
+
+// arenaRecycler frees retired spans into the free lists of an arena.
+type arenaRecycler struct {
+	arena *Arena
+}
+
+func (r arenaRecycler) Recycle(obj any) {
+	sp := obj.(span)
+	r.arena.freeGen(sp.gen, sp.offset, sp.size)
+}
+
+// retireValue frees the space of a value that is no longer current.
+func (s *Skiplist) retireValue(g *epoch.Guard, value uint64) {
+	if valOffset, valSize := s.valueSpan(value); valSize != 0 {
+		g.Retire(span{s.arena.generation(), valOffset, valSize}, arenaRecycler{s.arena})
+	}
+}
+
+// discard frees a node that was never linked, and its key and value.
+func (s *Skiplist) discard(nd *node) {
+	s.arena.Free(nd.span(s.arena))
+	s.arena.Free(nd.getKeyOffset(s.arena), nd.keySize)
+	s.freeValue(nd.value)
+}
+
+// freeValue frees the bytes of a value that was never published.
+func (s *Skiplist) freeValue(value uint64) {
+	s.arena.Free(s.valueSpan(value))
+}
+
+// mark marks every level of nd, from the top, so that nothing can be linked
+// after it. Levels that are not linked yet are marked too, which tells the
+// inserter to stop.
+func (s *Skiplist) mark(nd *node) {
+	for h := int(nd.height(s.arena)) - 1; h >= 0; h-- {
+		for {
+			raw := nd.nextOffset(s.arena, h)
+			if raw&marked != 0 || nd.casNextOffset(s.arena, h, raw, raw|marked) {
+				break
+			}
+		}
+	}
+}
+
+// snip runs a search for key, which unlinks the marked nodes on its way.
+func (s *Skiplist) snip(key []byte) {
+	prev := s.head
+	for level := int(s.Height() - 1); level >= 0; level-- {
+		prev, _, _ = s.findSpliceForLevel(key, level, prev)
+	}
+}
+
+// release drops a reference to nd. The last one makes sure that it is
+// unlinked at every level, which a slow inserter may have undone, moves the
+// prev offset of the node that followed it off it, and retires it.
+func (s *Skiplist) release(g *epoch.Guard, nd *node) {
+	if !nd.unref(s.arena) {
+		return
+	}
+	s.snip(nd.getKey(s.arena))
+	s.fixPrev(g, s.getNext(nd, 0), nd.getOffset(s.arena))
+	to, gen := arenaRecycler{s.arena}, s.arena.generation()
+	offset, size := nd.span(s.arena)
+	g.Retire(span{gen, offset, size}, to)
+	if nd.keySize != 0 {
+		g.Retire(span{gen, nd.getKeyOffset(s.arena), nd.keySize}, to)
+	}
+}
+
+// findSpliceUnlinking is findSpliceForLevel for a skiplist with reclamation.
+// It unlinks the marked nodes it comes across, and starts over from the
+// head if prev turns out to be marked.
+func (s *Skiplist) findSpliceUnlinking(key []byte, level int, start *node) (prev, next *node, found bool) {
+	prev = start
+	for {
+		raw := prev.nextOffset(s.arena, level)
+		if raw&marked != 0 {
+			prev = s.head
+			continue
+		}
+		next = (*node)(s.arena.GetPointer(raw))
+		nextKey := next.getKey(s.arena)
+		if nextKey == nil {
+			// Tail node key, so done.
+			return prev, next, false
+		}
+
+		if succ := next.nextOffset(s.arena, level); succ&marked != 0 {
+			succ &^= marked
+			// At level 0, the release of next moves the prev offset of succ
+			// off it.
+			if prev.casNextOffset(s.arena, level, raw, succ) && level != 0 {
+				prevOffset := prev.getOffset(s.arena)
+				(*node)(s.arena.GetPointer(succ)).casPrevOffset(s.arena, level, raw, prevOffset)
+			}
+			continue
+		}
+
+		cmp := s.compare(key, nextKey)
+		if cmp <= 0 {
+			return prev, next, cmp == 0
+		}
+		prev = next
+	}
+}
+
+// linkPrev points the level 0 prev offset of nd at prev, if it is still old.
+// The caller holds a reference to prev, which keeps it from being released
+// until the offset is known to be right.
+func (s *Skiplist) linkPrev(g *epoch.Guard, nd *node, old uint64, prev *node) {
+	prevOffset := prev.getOffset(s.arena)
+	if !nd.casPrevOffset(s.arena, 0, old, prevOffset) {
+		return
+	}
+	if prev.nextOffset(s.arena, 0) != nd.getOffset(s.arena) {
+		// A node was added in between, or prev is deleted.
+		s.fixPrev(g, nd, prevOffset)
+	}
+}
+
+// fixPrev points the level 0 prev offset of nd, as long as it is old, at the
+// node that links to nd. It gives up once nd is deleted, since iterators do
+// not follow the prev offset of a deleted node.
+func (s *Skiplist) fixPrev(g *epoch.Guard, nd *node, old uint64) {
+	for nd.prevOffset(s.arena, 0) == old && nd.nextOffset(s.arena, 0)&marked == 0 {
+		prev := s.findPrev(nd)
+		if prev == nil || !prev.tryRef(s.arena) {
+			// Either nd or prev is deleted. The loop stops for the one, and
+			// the next search unlinks the other.
+			continue
+		}
+		prevOffset := prev.getOffset(s.arena)
+		if nd.casPrevOffset(s.arena, 0, old, prevOffset) {
+			if prev.nextOffset(s.arena, 0) == nd.getOffset(s.arena) {
+				s.release(g, prev)
+				return
+			}
+			old = prevOffset
+		}
+		s.release(g, prev)
+	}
+}
+
+// stepBack returns the node before nd at level 0. Once nd is deleted, its
+// prev offset may point at a node that is already freed, so the node before
+// it is found by a search instead.
+func (s *Skiplist) stepBack(nd *node) *node {
+	if s.collector == nil || nd.nextOffset(s.arena, 0)&marked == 0 {
+		return s.getPrev(nd, 0)
+	}
+	prev, _ := s.searchLevel0(nd.getKey(s.arena))
+	return prev
+}
+
+// findPrev returns the node that links to nd at level 0, unlinking the marked
+// nodes on its way. It returns nil if nd is not linked, or if the search has
+// to start over.
+func (s *Skiplist) findPrev(nd *node) *node {
+	if nd != s.tail {
+		prev, next := s.searchLevel0(nd.getKey(s.arena))
+		if next != nd {
+			return nil
+		}
+		return prev
+	}
+
+	// The tail has no key to search for, so take the last node at every
+	// level instead.
+	prev := s.head
+	for level := int(s.Height() - 1); level >= 0; level-- {
+		for {
+			raw := prev.nextOffset(s.arena, level)
+			if raw&marked != 0 {
+				s.snip(prev.getKey(s.arena))
+				return nil
+			}
+			next := (*node)(s.arena.GetPointer(raw))
+			if next == s.tail {
+				break
+			}
+			prev = next
+		}
+	}
+	return prev
+}
+
+// searchLevel0 returns the nodes around key at level 0.
+func (s *Skiplist) searchLevel0(key []byte) (prev, next *node) {
+	prev = s.head
+	for level := int(s.Height() - 1); level >= 0; level-- {
+		prev, next, _ = s.findSpliceUnlinking(key, level, prev)
+	}
+	return prev, next
+}
@@ -20,7 +20,7 @@ Adapted from RocksDB inline skiplist.
 
 Key differences:
 - No optimization for sequential inserts (no "prev").
-- No custom comparator.
+- Custom comparator, given by WithComparer.
 - Support overwrites. This requires care when we see the same key when inserting.
   For RocksDB or LevelDB, overwrites are implemented as a newer sequence number in the key, so
 	there is no need for values. We don't intend to support versioning. In-place updates of values
@@ -39,15 +39,21 @@ Key differences:
   level code to deal with the intermediate state that occurs during insertion,
   where node A is linked to node B, but node B is not yet linked back to node A.
 - Iterator includes mutator functions.
+- Optional versioned records, keyed by (user key, sequence number) as in the
+  RocksDB memtable, for point-in-time iteration. See version.go.
 */
 
 package arenaskl
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"math"
+	"math/rand"
 	"skiplist/d_arena_skiplist/impl_actual/internal/fastrand"
+	"skiplist/epoch"
+	"sync"
 	"sync/atomic"
 	"unsafe"
 )
@@ -57,6 +63,14 @@ const (
 	pValue     = 1 / math.E
 	linksSize  = int(unsafe.Sizeof(links{}))
 	deletedVal = 0
+
+	// A tombstone has no value bytes. No value is ever allocated at offset 0,
+	// or at an odd offset in a chained arena.
+	tombstoneVal     = 1 << 32
+	wideTombstoneVal = 1
+
+	// The bits of a value that locate its bytes, as opposed to its metadata.
+	valueLocationMask = 1<<48 - 1
 )
 
 const MaxNodeSize = int(unsafe.Sizeof(node{}))
@@ -70,6 +84,23 @@ type Skiplist struct {
 	head   *node
 	tail   *node
 	height uint32 // Current height. 1 <= height <= maxHeight. CAS.
+	levels LevelGenerator
+	// Orders user keys, and the keys stored in the nodes, which are the same
+	// unless the skiplist is versioned.
+	cmp     Comparer
+	compare Comparer
+
+	// Sequence numbers of a versioned skiplist: the last one handed out and
+	// the last one visible to snapshots.
+	versioned bool
+	seq       uint64
+	visible   uint64
+
+	// Set if deleted nodes are unlinked and freed.
+	collector *epoch.Collector
+
+	// The options the skiplist was constructed with, for CompactInto.
+	opts []Option
 
 	// If set to true by tests, then extra delays are added to make it easier to
 	// detect unusual race conditions.
@@ -91,36 +122,100 @@ func init() {
 	}
 }
 
+// Option configures a Skiplist constructed by NewSkiplist.
+type Option func(*Skiplist)
+
+// LevelGenerator returns the tower height of the next node. Heights outside
+// [1, maxHeight] are clamped. It is called concurrently by every Add.
+type LevelGenerator func() uint32
+
+// WithLevelGenerator replaces the runtime's fastrand as the source of tower
+// heights.
+func WithLevelGenerator(g LevelGenerator) Option {
+	return func(s *Skiplist) { s.levels = g }
+}
+
+// Comparer orders keys. It returns a negative number if a < b, zero if
+// a == b and a positive number if a > b. It is called concurrently by every
+// Add and seek, and must not retain or modify its arguments.
+type Comparer func(a, b []byte) int
+
+// WithComparer replaces bytes.Compare as the order of the keys. Keys that
+// cmp reports as equal are the same record.
+func WithComparer(cmp Comparer) Option {
+	return func(s *Skiplist) { s.cmp = cmp }
+}
+
+// NewLevelGenerator returns a LevelGenerator with the default height
+// distribution, drawn from a source seeded with seed. Two skiplists given
+// generators with the same seed build identical towers for the same sequence
+// of single-threaded adds.
+func NewLevelGenerator(seed int64) LevelGenerator {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func() uint32 {
+		mu.Lock()
+		rnd := rng.Uint32()
+		mu.Unlock()
+		return heightFor(rnd)
+	}
+}
+
 // NewSkiplist constructs and initializes a new, empty skiplist. All nodes, keys,
 // and values in the skiplist will be allocated from the given arena.
-func NewSkiplist(arena *Arena) *Skiplist {
-	// Allocate head and tail nodes.
-	head, err := newNode(arena, maxHeight)
+func NewSkiplist(arena *Arena, opts ...Option) *Skiplist {
+	skl, err := newSkiplist(arena, opts)
 	if err != nil {
-		panic("arenaSize is not large enough to hold the head node")
+		panic("arenaSize is not large enough to hold the head and tail nodes")
 	}
+	return skl
+}
 
-	tail, err := newNode(arena, maxHeight)
+// newSkiplist is NewSkiplist, failing with ErrArenaFull if the head and tail
+// nodes do not fit into arena.
+func newSkiplist(arena *Arena, opts []Option) (*Skiplist, error) {
+	skl := &Skiplist{
+		arena:  arena,
+		height: 1,
+		levels: func() uint32 { return heightFor(fastrand.Uint32()) },
+		cmp:    bytes.Compare,
+		opts:   opts,
+	}
+	for _, opt := range opts {
+		opt(skl)
+	}
+	skl.compare = skl.cmp
+	if skl.versioned {
+		skl.compare = skl.compareVersions
+	}
+
+	// Allocate head and tail nodes. With reclamation, each holds a reference
+	// that is never dropped.
+	counted := skl.collector != nil
+	head, err := newNode(arena, maxHeight, counted)
 	if err != nil {
-		panic("arenaSize is not large enough to hold the tail node")
+		return nil, err
 	}
 
-	// Link all head/tail levels together.
-	headOffset := arena.GetPointerOffset(unsafe.Pointer(head))
-	tailOffset := arena.GetPointerOffset(unsafe.Pointer(tail))
-	for i := 0; i < maxHeight; i++ {
-		head.tower[i].nextOffset = tailOffset
-		tail.tower[i].prevOffset = headOffset
+	tail, err := newNode(arena, maxHeight, counted)
+	if err != nil {
+		return nil, err
+	}
+	if counted {
+		head.setRefs(arena, 1)
+		tail.setRefs(arena, 1)
 	}
 
-	skl := &Skiplist{
-		arena:  arena,
-		head:   head,
-		tail:   tail,
-		height: 1,
+	// Link all head/tail levels together.
+	headOffset := head.getOffset(arena)
+	tailOffset := tail.getOffset(arena)
+	for i := 0; i < maxHeight; i++ {
+		head.setNextOffset(arena, i, tailOffset)
+		tail.setPrevOffset(arena, i, headOffset)
 	}
+	skl.head, skl.tail = head, tail
 
-	return skl
+	return skl, nil
 }
 
 // Height returns the height of the highest tower within any of the nodes that
@@ -131,11 +226,11 @@ func (s *Skiplist) Height() uint32 { return atomic.LoadUint32(&s.height) }
 func (s *Skiplist) Arena() *Arena { return s.arena }
 
 // Size returns the number of bytes that have allocated from the arena.
-func (s *Skiplist) Size() uint32 { return s.arena.Size() }
+func (s *Skiplist) Size() uint64 { return s.arena.Size() }
 
-func (s *Skiplist) newNode(key, val []byte, meta uint16) (nd *node, height uint32, err error) {
+func (s *Skiplist) newNode(key, val []byte, meta uint16, kind uint64) (nd *node, height uint32, err error) {
 	height = s.randomHeight()
-	nd, err = newNode(s.arena, height)
+	nd, err = newNode(s.arena, height, s.collector != nil)
 	if err != nil {
 		return
 	}
@@ -152,18 +247,33 @@ func (s *Skiplist) newNode(key, val []byte, meta uint16) (nd *node, height uint3
 	}
 
 	// Allocate node's key and value.
-	nd.keyOffset, nd.keySize, err = s.allocKey(key)
+	var keyOffset uint64
+	keyOffset, nd.keySize, err = s.allocKey(key)
 	if err != nil {
 		return
 	}
+	nd.setKeyOffset(s.arena, keyOffset)
 
-	nd.value, err = s.allocVal(val, meta)
+	nd.value, err = s.newValue(val, meta, kind)
+	if s.collector != nil {
+		// The inserter and the deleter.
+		nd.setRefs(s.arena, 2)
+	}
 	return
 }
 
 func (s *Skiplist) randomHeight() uint32 {
-	rnd := fastrand.Uint32()
+	h := s.levels()
+	if h < 1 {
+		return 1
+	}
+	if h > maxHeight {
+		return maxHeight
+	}
+	return h
+}
 
+func heightFor(rnd uint32) uint32 {
 	h := uint32(1)
 	for h < maxHeight && rnd <= probabilities[h] {
 		h++
@@ -172,7 +282,7 @@ func (s *Skiplist) randomHeight() uint32 {
 	return h
 }
 
-func (s *Skiplist) allocKey(key []byte) (keyOffset uint32, keySize uint32, err error) {
+func (s *Skiplist) allocKey(key []byte) (keyOffset uint64, keySize uint32, err error) {
 	keySize = uint32(len(key))
 	if keySize > math.MaxUint32 {
 		panic("key is too large")
@@ -186,22 +296,81 @@ func (s *Skiplist) allocKey(key []byte) (keyOffset uint32, keySize uint32, err e
 	return
 }
 
+// newValue returns the value of a record of the given kind. A tombstone takes
+// no space in the arena.
+func (s *Skiplist) newValue(val []byte, meta uint16, kind uint64) (uint64, error) {
+	if kind == kindTombstone {
+		return s.tombstone(), nil
+	}
+	return s.allocVal(val, meta)
+}
+
+// tombstone returns the value of a tombstone.
+func (s *Skiplist) tombstone() uint64 {
+	if s.arena.wide() {
+		return wideTombstoneVal
+	}
+	return tombstoneVal
+}
+
 func (s *Skiplist) allocVal(val []byte, meta uint16) (uint64, error) {
 	if len(val) > math.MaxUint16 {
 		panic("value is too large")
 	}
 
 	valSize := uint16(len(val))
+	if s.arena.wide() {
+		// The offset takes the bits of the size, so the size goes in front
+		// of the bytes.
+		valOffset, err := s.arena.Alloc(2+uint32(valSize), 0 /* overflow */, Align2)
+		if err != nil {
+			return 0, err
+		}
+		buf := s.arena.GetBytes(valOffset, 2+uint32(valSize))
+		binary.LittleEndian.PutUint16(buf, valSize)
+		copy(buf[2:], val)
+		return uint64(meta)<<48 | valOffset, nil
+	}
+
 	valOffset, err := s.arena.Alloc(uint32(valSize), 0 /* overflow */, Align1)
 	if err != nil {
 		return 0, err
 	}
 
 	copy(s.arena.GetBytes(valOffset, uint32(valSize)), val)
-	return encodeValue(valOffset, valSize, meta), nil
+	return encodeValue(uint32(valOffset), valSize, meta), nil
+}
+
+// valueSpan returns the part of the arena that value takes, which is empty
+// for a tombstone.
+func (s *Skiplist) valueSpan(value uint64) (offset uint64, size uint32) {
+	if value == s.tombstone() {
+		return 0, 0
+	}
+	if s.arena.wide() {
+		offset = value & valueLocationMask
+		if offset == 0 {
+			return 0, 0
+		}
+		return offset, 2 + uint32(binary.LittleEndian.Uint16(s.arena.GetBytes(offset, 2)))
+	}
+	valOffset, valSize := decodeValue(value)
+	return uint64(valOffset), uint32(valSize)
+}
+
+// valueBytes returns the bytes of value.
+func (s *Skiplist) valueBytes(value uint64) []byte {
+	offset, size := s.valueSpan(value)
+	if s.arena.wide() && size != 0 {
+		offset, size = offset+2, size-2
+	}
+	return s.arena.GetBytes(offset, size)
 }
 
 func (s *Skiplist) findSpliceForLevel(key []byte, level int, start *node) (prev, next *node, found bool) {
+	if s.collector != nil {
+		return s.findSpliceUnlinking(key, level, start)
+	}
 	prev = start
 
 	for {
@@ -213,7 +382,7 @@ func (s *Skiplist) findSpliceForLevel(key []byte, level int, start *node) (prev,
 			break
 		}
 
-		cmp := bytes.Compare(key, nextKey)
+		cmp := s.compare(key, nextKey)
 		if cmp == 0 {
 			// Equality case.
 			found = true
@@ -233,12 +402,12 @@ func (s *Skiplist) findSpliceForLevel(key []byte, level int, start *node) (prev,
 }
 
 func (s *Skiplist) getNext(nd *node, h int) *node {
-	offset := atomic.LoadUint32(&nd.tower[h].nextOffset)
+	offset := nd.nextOffset(s.arena, h) &^ marked
 	return (*node)(s.arena.GetPointer(offset))
 }
 
 func (s *Skiplist) getPrev(nd *node, h int) *node {
-	offset := atomic.LoadUint32(&nd.tower[h].prevOffset)
+	offset := nd.prevOffset(s.arena, h)
 	return (*node)(s.arena.GetPointer(offset))
 }
 
@@ -252,6 +421,13 @@ func decodeValue(value uint64) (valOffset uint32, valSize uint16) {
 	return
 }
 
+// decodeMeta returns the metadata of a value, which is in the same place in
+// both encodings.
 func decodeMeta(value uint64) uint16 {
 	return uint16(value >> 48)
 }
+
+// withMeta returns value with its metadata replaced by meta.
+func withMeta(value uint64, meta uint16) uint64 {
+	return value&valueLocationMask | uint64(meta)<<48
+}
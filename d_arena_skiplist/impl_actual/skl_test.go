@@ -18,14 +18,19 @@
 package arenaskl
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
+	"runtime"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
+
+	"skiplist/epoch"
 
 	"github.com/stretchr/testify/require"
 )
@@ -84,6 +89,17 @@ func TestEmpty(t *testing.T) {
 	require.False(t, it.Valid())
 }
 
+// TestNodeSize tests that the fixed part of a node stays at 16 bytes, and
+// that a wide node starts with the same fields.
+func TestNodeSize(t *testing.T) {
+	require.EqualValues(t, 16, unsafe.Offsetof(node{}.tower))
+	require.Equal(t, 16+maxHeight*linksSize, MaxNodeSize)
+
+	require.Equal(t, unsafe.Offsetof(node{}.keySize), unsafe.Offsetof(wideNode{}.keySize))
+	require.Equal(t, unsafe.Offsetof(node{}.value), unsafe.Offsetof(wideNode{}.value))
+	require.EqualValues(t, 32, unsafe.Offsetof(wideNode{}.tower))
+}
+
 func TestFull(t *testing.T) {
 	l := NewSkiplist(NewArena(1000))
 
@@ -149,6 +165,35 @@ func TestBasic(t *testing.T) {
 	require.True(t, !it.Valid())
 }
 
+// TestLevelGenerator tests that seeded generators replay the same towers and
+// that out of range heights are clamped.
+func TestLevelGenerator(t *testing.T) {
+	build := func(opts ...Option) *Skiplist {
+		l := NewSkiplist(NewArena(arenaSize), opts...)
+		var it Iterator
+		it.Init(l)
+		for i := 0; i < 1000; i++ {
+			require.Nil(t, it.Add([]byte(fmt.Sprintf("%05d", i)), newValue(i), 0))
+		}
+		return l
+	}
+
+	// Tower heights determine how much of the arena each node uses.
+	l1 := build(WithLevelGenerator(NewLevelGenerator(7)))
+	l2 := build(WithLevelGenerator(NewLevelGenerator(7)))
+	require.Equal(t, l1.Size(), l2.Size())
+	require.Equal(t, l1.Height(), l2.Height())
+
+	l := build(WithLevelGenerator(func() uint32 { return maxHeight + 1 }))
+	require.EqualValues(t, maxHeight, l.Height())
+	require.Equal(t, 1000, length(l))
+	require.Equal(t, 1000, lengthRev(l))
+
+	l = build(WithLevelGenerator(func() uint32 { return 0 }))
+	require.EqualValues(t, 1, l.Height())
+	require.Equal(t, 1000, lengthRev(l))
+}
+
 // TestConcurrentBasic tests concurrent writes followed by concurrent reads.
 func TestConcurrentBasic(t *testing.T) {
 	const n = 1000
@@ -594,6 +639,54 @@ func TestIteratorPrev(t *testing.T) {
 	require.False(t, it.Valid())
 }
 
+// TestRangeFunc tests All, Backward and Range with range-over-func loops,
+// including breaking out of them early.
+func TestRangeFunc(t *testing.T) {
+	const n = 10
+	l := NewSkiplist(NewArena(arenaSize))
+
+	var it Iterator
+	it.Init(l)
+	for i := 0; i < n; i++ {
+		it.Add([]byte(fmt.Sprintf("%05d", i)), newValue(i), 0)
+	}
+	// Deleted records are skipped.
+	it.Seek([]byte("00005"))
+	require.Nil(t, it.Delete())
+
+	var got []int
+	for key, val := range l.All() {
+		require.EqualValues(t, key, val)
+		i, _ := strconv.Atoi(string(key))
+		got = append(got, i)
+	}
+	require.Equal(t, []int{0, 1, 2, 3, 4, 6, 7, 8, 9}, got)
+
+	got = got[:0]
+	for key := range l.Backward() {
+		i, _ := strconv.Atoi(string(key))
+		got = append(got, i)
+		if i == 7 {
+			break
+		}
+	}
+	require.Equal(t, []int{9, 8, 7}, got)
+
+	got = got[:0]
+	for key := range l.RangeSeq([]byte("00003"), []byte("00007")) {
+		i, _ := strconv.Atoi(string(key))
+		got = append(got, i)
+	}
+	require.Equal(t, []int{3, 4, 6}, got)
+
+	got = got[:0]
+	for key := range l.RangeSeq([]byte("00008"), nil) {
+		i, _ := strconv.Atoi(string(key))
+		got = append(got, i)
+	}
+	require.Equal(t, []int{8, 9}, got)
+}
+
 func TestIteratorSeek(t *testing.T) {
 	const n = 100
 	l := NewSkiplist(NewArena(arenaSize))
@@ -743,6 +836,367 @@ func randomKey(rng *rand.Rand) []byte {
 	return b
 }
 
+// TestReverseComparer tests a skiplist that orders keys from the largest to
+// the smallest.
+func TestReverseComparer(t *testing.T) {
+	const n = 100
+	reverse := func(a, b []byte) int { return bytes.Compare(b, a) }
+	l := NewSkiplist(NewArena(arenaSize), WithComparer(reverse))
+
+	var it Iterator
+	it.Init(l)
+	for i := 0; i < n; i += 2 {
+		require.Nil(t, it.Add([]byte(fmt.Sprintf("%05d", i)), newValue(i), 0))
+	}
+	require.Equal(t, ErrRecordExists, it.Add([]byte("00010"), newValue(0), 0))
+	require.EqualValues(t, newValue(10), it.Value())
+
+	i := n - 2
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		require.EqualValues(t, newValue(i), it.Value())
+		i -= 2
+	}
+	require.Equal(t, -2, i)
+	require.Equal(t, n/2, lengthRev(l))
+
+	require.True(t, it.Seek([]byte("00050")))
+	require.EqualValues(t, newValue(50), it.Value())
+	require.False(t, it.Seek([]byte("00051")))
+	require.EqualValues(t, newValue(50), it.Value())
+	require.False(t, it.SeekForPrev([]byte("00051")))
+	require.EqualValues(t, newValue(52), it.Value())
+
+	var keys []string
+	for key := range l.RangeSeq([]byte("00009"), []byte("00003")) {
+		keys = append(keys, string(key))
+	}
+	require.Equal(t, []string{"00008", "00006", "00004"}, keys)
+}
+
+// TestPrefixComparer tests a skiplist of keys made of a table id, encoded as
+// a uvarint, and a name. Tables are ordered by id, which the bytes of their
+// uvarints are not.
+func TestPrefixComparer(t *testing.T) {
+	split := func(key []byte) (uint64, []byte) {
+		id, n := binary.Uvarint(key)
+		return id, key[n:]
+	}
+	cmp := func(a, b []byte) int {
+		idA, nameA := split(a)
+		idB, nameB := split(b)
+		switch {
+		case idA < idB:
+			return -1
+		case idA > idB:
+			return 1
+		}
+		return bytes.Compare(nameA, nameB)
+	}
+	makeKey := func(id uint64, name string) []byte {
+		return append(binary.AppendUvarint(nil, id), name...)
+	}
+
+	for _, opts := range [][]Option{{WithComparer(cmp)}, {WithComparer(cmp), WithVersions()}} {
+		l := NewSkiplist(NewArena(arenaSize), opts...)
+		var it Iterator
+		it.Init(l)
+		// 129 encodes as 81 01 and 256 as 80 02.
+		for _, id := range []uint64{256, 2, 129} {
+			for _, name := range []string{"b", "a"} {
+				require.Nil(t, it.Add(makeKey(id, name), []byte(fmt.Sprint(id, name)), 0))
+			}
+		}
+
+		var got []string
+		for _, val := range l.All() {
+			got = append(got, string(val))
+		}
+		require.Equal(t, []string{"2a", "2b", "129a", "129b", "256a", "256b"}, got)
+
+		got = got[:0]
+		for _, val := range l.RangeSeq(makeKey(129, "b"), makeKey(256, "")) {
+			got = append(got, string(val))
+		}
+		require.Equal(t, []string{"129b"}, got)
+
+		require.False(t, it.Seek(makeKey(129, "c")))
+		require.EqualValues(t, "256a", it.Value())
+		require.True(t, it.SeekForPrev(makeKey(129, "b")))
+		it.Prev()
+		require.EqualValues(t, "129a", it.Value())
+	}
+}
+
+// scan returns the key=value pairs an iterator at snapshot seq sees, in
+// both directions.
+func scan(l *Skiplist, seq uint64) (fwd, rev []string) {
+	var it Iterator
+	it.InitAt(l, seq)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		fwd = append(fwd, string(it.Key())+"="+string(it.Value()))
+	}
+	for it.SeekToLast(); it.Valid(); it.Prev() {
+		rev = append([]string{string(it.Key()) + "=" + string(it.Value())}, rev...)
+	}
+	return
+}
+
+// TestVersions tests that iterators of a versioned skiplist see the list as
+// of their snapshot.
+func TestVersions(t *testing.T) {
+	l := NewSkiplist(NewArena(arenaSize), WithVersions())
+
+	var it Iterator
+	it.Init(l)
+	require.Nil(t, it.Add([]byte("a"), []byte("1"), 0))
+	require.Nil(t, it.Add([]byte("ab"), []byte("1"), 0))
+	snap1 := l.NewSnapshot()
+	require.Nil(t, it.Add([]byte("a"), []byte("2"), 0))
+	require.Nil(t, it.Add([]byte("b"), []byte("1"), 0))
+	snap2 := l.NewSnapshot()
+	require.Nil(t, it.AddTombstone([]byte("a")))
+	require.Nil(t, it.Add([]byte("ab"), []byte("2"), 0))
+
+	for _, tc := range []struct {
+		seq  uint64
+		want []string
+	}{
+		{0, nil},
+		{snap1, []string{"a=1", "ab=1"}},
+		{snap2, []string{"a=2", "ab=1", "b=1"}},
+		{l.NewSnapshot(), []string{"ab=2", "b=1"}},
+	} {
+		fwd, rev := scan(l, tc.seq)
+		require.Equal(t, tc.want, fwd, "snapshot %d", tc.seq)
+		require.Equal(t, tc.want, rev, "snapshot %d", tc.seq)
+	}
+
+	it.InitAt(l, snap2)
+	require.True(t, it.Seek([]byte("a")))
+	require.EqualValues(t, "2", it.Value())
+	require.False(t, it.Seek([]byte("aa")))
+	require.EqualValues(t, "ab", it.Key())
+	require.False(t, it.SeekForPrev([]byte("aa")))
+	require.EqualValues(t, "a", it.Key())
+	require.True(t, it.SeekForPrev([]byte("ab")))
+	require.EqualValues(t, "1", it.Value())
+
+	// The latest view, which Init gives, does not see deleted keys.
+	it.Init(l)
+	require.False(t, it.Seek([]byte("a")))
+	require.EqualValues(t, "ab", it.Key())
+	require.Equal(t, ErrRecordVersioned, it.Set([]byte("3"), 0))
+	require.Equal(t, ErrRecordVersioned, it.Delete())
+}
+
+// TestConcurrentVersions tests that a snapshot gives the same view while
+// writers keep adding newer versions.
+func TestConcurrentVersions(t *testing.T) {
+	const n = 100
+	l := NewSkiplist(NewArena(arenaSize), WithVersions())
+	l.testing = true
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			var it Iterator
+			it.Init(l)
+			for i := 0; i < n; i++ {
+				key := []byte(fmt.Sprintf("%05d", (w*n+i)%(n/2)))
+				if i%10 == 9 {
+					require.Nil(t, it.AddTombstone(key))
+				} else {
+					require.Nil(t, it.Add(key, newValue(w*n+i), 0))
+				}
+				if i%20 == 0 {
+					snap := l.NewSnapshot()
+					fwd, rev := scan(l, snap)
+					require.Equal(t, fwd, rev)
+					runtime.Gosched()
+					again, _ := scan(l, snap)
+					require.Equal(t, fwd, again)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	require.Equal(t, uint64(4*n), l.NewSnapshot())
+}
+
+// TestVersionsStalledWriter tests that a versioned Add that gets its sequence
+// number after a stalled one waits for it, without holding up the scheduler.
+func TestVersionsStalledWriter(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	l := NewSkiplist(NewArena(arenaSize), WithVersions())
+
+	// A writer that has its sequence number, but has not published it.
+	stalled := atomic.AddUint64(&l.seq, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var it Iterator
+		it.Init(l)
+		require.Nil(t, it.Add([]byte("a"), []byte("1"), 0))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Add published before an earlier sequence number")
+	default:
+	}
+	require.Equal(t, uint64(0), l.NewSnapshot())
+
+	l.publish(stalled)
+	<-done
+	require.Equal(t, uint64(2), l.NewSnapshot())
+}
+
+// TestReclaimUnlink tests that a deleted node is unlinked from the list at
+// once when the skiplist has reclamation enabled.
+func TestReclaimUnlink(t *testing.T) {
+	l := NewSkiplist(NewArena(arenaSize), WithReclamation(epoch.NewCollector()))
+
+	var it Iterator
+	it.Init(l)
+	defer it.Close()
+
+	for i := 1; i <= 3; i++ {
+		require.Nil(t, it.Add(newValue(i), newValue(i), 0))
+	}
+
+	require.True(t, it.Seek(newValue(2)))
+	require.Nil(t, it.Delete())
+	require.EqualValues(t, newValue(3), it.Key())
+
+	// Level 0 goes straight from the first node to the last.
+	first := l.getNext(l.head, 0)
+	require.EqualValues(t, newValue(1), first.getKey(l.arena))
+	require.EqualValues(t, newValue(3), l.getNext(first, 0).getKey(l.arena))
+
+	// Reverse iteration does not see it either.
+	it.SeekToLast()
+	require.EqualValues(t, newValue(3), it.Key())
+	it.Prev()
+	require.EqualValues(t, newValue(1), it.Key())
+	it.Prev()
+	require.False(t, it.Valid())
+
+	// A deleted key can be added again, as a new node.
+	require.False(t, it.Seek(newValue(2)))
+	require.Nil(t, it.Add(newValue(2), []byte("again"), 0))
+	require.EqualValues(t, "again", it.Value())
+
+	var keys []string
+	for key := range l.Backward() {
+		keys = append(keys, string(key))
+	}
+	require.Equal(t, []string{"00003", "00002", "00001"}, keys)
+}
+
+// TestReclaimReuse tests that the space of deleted nodes and of replaced
+// values is reused, so that a skiplist with a steady number of records never
+// fills its arena.
+func TestReclaimReuse(t *testing.T) {
+	l := NewSkiplist(NewArena(1<<16), WithReclamation(epoch.NewCollector()))
+
+	var it Iterator
+	for i := 0; i < 20000; i++ {
+		// Initialize again now and then, so that the epoch can advance.
+		it.Init(l)
+		key := newValue(i % 50)
+		require.Nil(t, it.Add(key, newValue(i), 0))
+		require.Nil(t, it.Set(newValue(i+1), 0))
+		require.Nil(t, it.Delete())
+	}
+	it.Close()
+
+	require.Equal(t, 0, length(l))
+	require.Less(t, l.Size(), uint64(1<<16))
+}
+
+// TestReclaimConcurrent races adds, deletes and iterators in both directions
+// over a skiplist with reclamation enabled.
+func TestReclaimConcurrent(t *testing.T) {
+	const n = 2000
+	const keys = 64
+
+	l := NewSkiplist(NewArena(arenaSize), WithReclamation(epoch.NewCollector()))
+	l.testing = true
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			var it Iterator
+			for i := 0; i < n; i++ {
+				it.Init(l)
+				key := newValue(rng.Intn(keys))
+				if it.Add(key, key, 0) == ErrRecordExists {
+					it.Delete()
+				}
+			}
+			it.Close()
+		}(g)
+	}
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func(reverse bool) {
+			defer wg.Done()
+			for i := 0; i < n/20; i++ {
+				var prev []byte
+				seq := l.All()
+				if reverse {
+					seq = l.Backward()
+				}
+				for key, val := range seq {
+					require.Equal(t, key, val)
+					if prev != nil {
+						require.Equal(t, reverse, bytes.Compare(key, prev) < 0)
+					}
+					prev = key
+				}
+			}
+		}(g == 1)
+	}
+	wg.Wait()
+
+	var fwd, rev [][]byte
+	for key := range l.All() {
+		fwd = append(fwd, key)
+	}
+	for key := range l.Backward() {
+		rev = append([][]byte{key}, rev...)
+	}
+	require.Equal(t, fwd, rev)
+
+	// Every level holds a subset of the level below, in order.
+	for level := int(l.Height()) - 1; level >= 0; level-- {
+		var prev []byte
+		for nd := l.getNext(l.head, level); nd != l.tail; nd = l.getNext(nd, level) {
+			key := nd.getKey(l.arena)
+			require.NotEqual(t, deletedVal, nd.value)
+			if prev != nil {
+				require.Equal(t, -1, bytes.Compare(prev, key))
+			}
+			prev = key
+		}
+	}
+
+	// Once the writers are done, every level 0 prev offset points at the
+	// node before it.
+	for nd := l.head; nd != l.tail; {
+		next := l.getNext(nd, 0)
+		require.Equal(t, nd, l.getPrev(next, 0))
+		nd = next
+	}
+}
+
 // Standard test. Some fraction is read. Some fraction is write.
 func BenchmarkReadWrite(b *testing.B) {
 	value := newValue(123)
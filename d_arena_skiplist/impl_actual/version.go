@@ -0,0 +1,178 @@
+package arenaskl
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"skiplist/internal/backoff"
+)
+
+// A versioned skiplist, enabled by WithVersions, keeps every value ever added
+// for a key, the way the memtables of RocksDB and Pebble do. Each Add gets the
+// next sequence number of the list, and its record is stored under the user
+// key followed by a trailer:
+//
+//	user key | seqNum<<8 | kind (8 bytes, little-endian)
+//
+// Records sort by user key, then from the newest version to the oldest. An
+// iterator reads the list as of a snapshot sequence number: for every user
+// key, it shows the newest version that is not newer than the snapshot,
+// unless that version is a tombstone added by AddTombstone.
+
+const (
+	trailerLen = 8
+	maxSeqNum  = 1<<56 - 1
+)
+
+const (
+	kindTombstone = 0
+	kindValue     = 1
+)
+
+var ErrRecordVersioned = errors.New("records of a versioned skiplist cannot be changed in place")
+
+// WithVersions makes the skiplist keep multiple versions of each key.
+func WithVersions() Option {
+	return func(s *Skiplist) { s.versioned = true }
+}
+
+// NewSnapshot returns the sequence number of the latest Add that is visible,
+// that is, of the latest one that has completed along with every Add before
+// it. An iterator initialized with InitAt at that sequence number sees the
+// list as it is now, however many versions are added after.
+func (s *Skiplist) NewSnapshot() uint64 {
+	return atomic.LoadUint64(&s.visible)
+}
+
+// InitAt associates the iterator with a versioned skiplist and resets all
+// state, so that it reads the list as of the snapshot seq.
+func (it *Iterator) InitAt(list *Skiplist, seq uint64) {
+	it.Init(list)
+	it.snapshot = seq
+}
+
+// AddTombstone adds a version of key that hides the older ones, which is how
+// keys are deleted from a versioned skiplist.
+func (it *Iterator) AddTombstone(key []byte) error {
+	if !it.list.versioned {
+		panic("AddTombstone requires a versioned skiplist")
+	}
+	return it.addVersion(key, nil, 0, kindTombstone)
+}
+
+// addVersion adds key under the next sequence number of the list.
+func (it *Iterator) addVersion(key, val []byte, meta uint16, kind uint64) error {
+	s := it.list
+	seq := atomic.AddUint64(&s.seq, 1)
+	if seq > maxSeqNum {
+		panic("sequence number overflow")
+	}
+	defer s.publish(seq)
+
+	versionKey := make([]byte, len(key)+trailerLen)
+	copy(versionKey, key)
+	binary.LittleEndian.PutUint64(versionKey[len(key):], seq<<8|kind)
+	return it.add(versionKey, val, meta, kind)
+}
+
+// publish makes seq visible to new snapshots once every earlier sequence
+// number is, so that a snapshot never misses a version older than itself.
+// Adds that fail publish their sequence number all the same. While an
+// earlier Add is stalled, the later ones back off instead of spinning.
+func (s *Skiplist) publish(seq uint64) {
+	var b backoff.Backoff
+	for atomic.LoadUint64(&s.visible) != seq-1 {
+		b.Wait()
+	}
+	atomic.StoreUint64(&s.visible, seq)
+}
+
+// compareVersions orders the keys of a versioned skiplist.
+func (s *Skiplist) compareVersions(a, b []byte) int {
+	if cmp := s.cmp(userKey(a), userKey(b)); cmp != 0 {
+		return cmp
+	}
+	// Newer versions first.
+	ta, tb := trailer(a), trailer(b)
+	switch {
+	case ta > tb:
+		return -1
+	case ta < tb:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func userKey(key []byte) []byte { return key[:len(key)-trailerLen] }
+
+func trailer(key []byte) uint64 {
+	return binary.LittleEndian.Uint64(key[len(key)-trailerLen:])
+}
+
+// seekKey returns the key that sorts before every version of key that is
+// visible at seq and after every newer one.
+func seekKey(key []byte, seq uint64) []byte {
+	out := make([]byte, len(key)+trailerLen)
+	copy(out, key)
+	binary.LittleEndian.PutUint64(out[len(key):], seq<<8|0xff)
+	return out
+}
+
+// setVersion is setNode for a versioned skiplist. Going forward, it positions
+// the iterator on the visible version of the first user key from nd on that
+// has one which is not a tombstone. nd must be the newest version of its
+// user key that is not yet passed. Going in reverse, it does the same for
+// the last such user key up to nd, which must be the oldest version of its
+// user key that is not yet passed.
+func (it *Iterator) setVersion(nd *node, reverse bool) {
+	s := it.list
+	if reverse {
+		for nd != nil && nd != s.head {
+			ukey := userKey(nd.getKey(it.arena))
+			var visible *node
+			for ; nd != s.head && s.cmp(userKey(nd.getKey(it.arena)), ukey) == 0; nd = s.getPrev(nd, 0) {
+				if trailer(nd.getKey(it.arena))>>8 <= it.snapshot {
+					visible = nd
+				}
+			}
+			if visible != nil && (trailer(visible.getKey(it.arena))&0xff == kindValue || it.tombstones) {
+				it.nd, it.value = visible, atomic.LoadUint64(&visible.value)
+				return
+			}
+		}
+	} else {
+		for nd != nil && nd != s.tail {
+			t := trailer(nd.getKey(it.arena))
+			if t>>8 > it.snapshot {
+				nd = s.getNext(nd, 0)
+				continue
+			}
+			if t&0xff == kindValue || it.tombstones {
+				it.nd, it.value = nd, atomic.LoadUint64(&nd.value)
+				return
+			}
+			nd = it.skipVersions(nd, false)
+		}
+	}
+	it.nd, it.value = nil, 0
+}
+
+// skipVersions returns the first node past nd, in the given direction, that
+// holds a different user key.
+func (it *Iterator) skipVersions(nd *node, reverse bool) *node {
+	s := it.list
+	ukey := userKey(nd.getKey(it.arena))
+	for {
+		if reverse {
+			nd = s.getPrev(nd, 0)
+		} else {
+			nd = s.getNext(nd, 0)
+		}
+		if nd == nil || nd == s.head || nd == s.tail ||
+			s.cmp(userKey(nd.getKey(it.arena)), ukey) != 0 {
+			return nd
+		}
+	}
+}
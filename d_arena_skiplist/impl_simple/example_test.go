@@ -0,0 +1,26 @@
+package simpleskl
+
+import "fmt"
+
+func Example() {
+	arena := NewArena(1024 * 1024) // 1MB arena
+	sl := NewSkiplist(arena)
+
+	sl.Insert(3)
+	sl.Insert(6)
+	sl.Insert(7)
+	sl.Insert(9)
+	sl.Insert(12)
+	sl.Insert(19)
+	sl.Insert(17)
+
+	fmt.Println("Contains 6:", sl.Contains(6))
+	fmt.Println("Contains 15:", sl.Contains(15))
+
+	bulk := FromSorted(NewArena(1024*1024), []uint64{3, 6, 7, 9, 12, 17, 19})
+	fmt.Println("Bulk contains 17:", bulk.Contains(17))
+	// Output:
+	// Contains 6: true
+	// Contains 15: false
+	// Bulk contains 17: true
+}
@@ -1,9 +1,9 @@
-package main
+// Package simpleskl is a minimal skiplist of uint64 keys whose nodes live in
+// an arena and link to each other by offset instead of by pointer.
+package simpleskl
 
 import (
-	"fmt"
 	"math/rand"
-	"time"
 	"unsafe"
 )
 
@@ -21,9 +21,38 @@ type Skiplist struct {
 	head     uint64 // Store offset of head
 	maxLevel int
 	arena    *Arena
+	levels   LevelGenerator
 }
 
-func NewSkiplist(arena *Arena) *Skiplist {
+// Option configures a Skiplist at construction time.
+type Option func(*Skiplist)
+
+// LevelGenerator returns the level of the next inserted node, in the range
+// [1, MaxLevel].
+type LevelGenerator func() int
+
+// WithLevelGenerator makes the list draw node levels from g instead of the
+// global math/rand source.
+func WithLevelGenerator(g LevelGenerator) Option {
+	return func(sl *Skiplist) { sl.levels = g }
+}
+
+// NewLevelGenerator returns a LevelGenerator that replays the same levels for
+// the same seed.
+func NewLevelGenerator(seed int64) LevelGenerator {
+	rng := rand.New(rand.NewSource(seed))
+	return func() int { return geometricLevel(rng.Float64) }
+}
+
+func geometricLevel(next func() float64) int {
+	level := 1
+	for next() < P && level < MaxLevel {
+		level++
+	}
+	return level
+}
+
+func NewSkiplist(arena *Arena, opts ...Option) *Skiplist {
 	headOffset, err := arena.Alloc(uint64(unsafe.Sizeof(Node{})))
 	if err != nil {
 		panic("failed to allocate head node")
@@ -31,11 +60,51 @@ func NewSkiplist(arena *Arena) *Skiplist {
 	head := (*Node)(unsafe.Pointer(&arena.buf[headOffset]))
 	*head = Node{} // Initialize the head node
 
-	return &Skiplist{
+	sl := &Skiplist{
 		head:     headOffset,
 		maxLevel: 1,
 		arena:    arena,
+		levels:   func() int { return geometricLevel(rand.Float64) },
 	}
+	for _, opt := range opts {
+		opt(sl)
+	}
+	return sl
+}
+
+// FromSorted builds a skiplist from keys in ascending order in a single pass,
+// appending each node to the end of every level it reaches.
+func FromSorted(arena *Arena, keys []uint64, opts ...Option) *Skiplist {
+	sl := NewSkiplist(arena, opts...)
+
+	// Rightmost node at each level so far.
+	var last [MaxLevel]uint64
+	for i := range last {
+		last[i] = sl.head
+	}
+
+	for i, key := range keys {
+		if i > 0 && keys[i-1] > key {
+			panic("keys are not sorted")
+		}
+
+		level := sl.randomLevel()
+		if level > sl.maxLevel {
+			sl.maxLevel = level
+		}
+
+		nodeOffset, err := sl.arena.Alloc(uint64(unsafe.Sizeof(Node{})))
+		if err != nil {
+			panic("failed to allocate new node")
+		}
+		sl.getNode(nodeOffset).key = key
+
+		for l := 0; l < level; l++ {
+			sl.getNode(last[l]).next[l] = nodeOffset
+			last[l] = nodeOffset
+		}
+	}
+	return sl
 }
 
 func (sl *Skiplist) getNode(offset uint64) *Node {
@@ -43,9 +112,12 @@ func (sl *Skiplist) getNode(offset uint64) *Node {
 }
 
 func (sl *Skiplist) randomLevel() int {
-	level := 1
-	for rand.Float64() < P && level < MaxLevel {
-		level++
+	level := sl.levels()
+	if level < 1 {
+		return 1
+	}
+	if level > MaxLevel {
+		return MaxLevel
 	}
 	return level
 }
@@ -91,20 +163,3 @@ func (sl *Skiplist) Contains(key uint64) bool {
 	x = sl.getNode(x).next[0]
 	return x != 0 && sl.getNode(x).key == key
 }
-
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	arena := NewArena(1024 * 1024) // 1MB arena
-	sl := NewSkiplist(arena)
-
-	sl.Insert(3)
-	sl.Insert(6)
-	sl.Insert(7)
-	sl.Insert(9)
-	sl.Insert(12)
-	sl.Insert(19)
-	sl.Insert(17)
-
-	fmt.Println("Contains 6:", sl.Contains(6))
-	fmt.Println("Contains 15:", sl.Contains(15))
-}
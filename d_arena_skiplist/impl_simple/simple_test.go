@@ -0,0 +1,68 @@
+package simpleskl
+
+import (
+	"reflect"
+	"testing"
+)
+
+// heights returns the number of levels each node is linked at, in key order.
+func heights(sl *Skiplist) []int {
+	count := map[uint64]int{}
+	for level := 0; level < MaxLevel; level++ {
+		for x := sl.getNode(sl.head).next[level]; x != 0; x = sl.getNode(x).next[level] {
+			count[x]++
+		}
+	}
+	var out []int
+	for x := sl.getNode(sl.head).next[0]; x != 0; x = sl.getNode(x).next[0] {
+		out = append(out, count[x])
+	}
+	return out
+}
+
+func TestFromSorted(t *testing.T) {
+	const n = 500
+	keys := make([]uint64, n)
+	for i := range keys {
+		keys[i] = uint64(i) * 2
+	}
+
+	bulk := FromSorted(NewArena(1<<20), keys, WithLevelGenerator(NewLevelGenerator(7)))
+	for _, key := range keys {
+		if !bulk.Contains(key) {
+			t.Fatalf("Expected bulk build to contain %d", key)
+		}
+	}
+	for _, key := range []uint64{1, 501, n * 2, 1 << 40} {
+		if bulk.Contains(key) {
+			t.Errorf("Expected bulk build not to contain %d", key)
+		}
+	}
+
+	// Ascending Inserts draw the same levels in the same order.
+	incremental := NewSkiplist(NewArena(1<<20), WithLevelGenerator(NewLevelGenerator(7)))
+	for _, key := range keys {
+		incremental.Insert(key)
+	}
+	if !reflect.DeepEqual(heights(incremental), heights(bulk)) {
+		t.Errorf("Expected bulk build to match incremental heights")
+	}
+	if bulk.maxLevel != incremental.maxLevel {
+		t.Errorf("Expected: %v, Got: %v", incremental.maxLevel, bulk.maxLevel)
+	}
+
+	// The list stays usable for later inserts.
+	bulk.Insert(3)
+	if !bulk.Contains(3) || !bulk.Contains(2) || !bulk.Contains(4) {
+		t.Errorf("Expected 2, 3 and 4 after inserting into the bulk build")
+	}
+}
+
+func TestFromSortedUnsorted(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic on unsorted keys")
+		}
+	}()
+	FromSorted(NewArena(1<<16), []uint64{2, 1})
+}
@@ -0,0 +1,160 @@
+// Package epoch implements epoch-based memory reclamation for the concurrent
+// skip lists, so that unlinked nodes and reference boxes can be reused instead
+// of being left to the garbage collector.
+//
+// A goroutine pins a Guard for the duration of an operation. Objects it
+// unlinks are retired on the guard together with the Recycler they go back
+// to, typically a Pool. The global epoch only advances once every pinned
+// guard has observed the current one, and an object retired in epoch e is
+// recycled once the global epoch reaches e+2: by then no guard that was
+// pinned when the object was still reachable can be pinned any more.
+package epoch
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// advanceEvery is how many retirements a guard makes between attempts to
+// advance the global epoch.
+const advanceEvery = 64
+
+// Recycler takes back objects once no goroutine can still see them.
+type Recycler interface {
+	Recycle(obj any)
+}
+
+// Collector holds the global epoch and the guards registered with it. Guards
+// are created on demand and reused, so there are about as many as there are
+// goroutines pinned at the same time.
+type Collector struct {
+	epoch  atomic.Uint64
+	next   atomic.Uint32 // where the search for a free guard starts
+	mu     sync.Mutex    // serializes registration of new guards
+	guards atomic.Pointer[[]*Guard]
+}
+
+// Guard is pinned by one goroutine at a time. While pinned, nothing retired
+// after the pin is recycled, so the goroutine may keep following pointers it
+// loaded from shared memory.
+type Guard struct {
+	c     *Collector
+	owned atomic.Bool
+	// state is epoch<<1 | 1 while pinned and 0 otherwise.
+	state   atomic.Uint64
+	bags    [3]bag
+	retired int
+}
+
+type bag struct {
+	epoch uint64
+	items []item
+}
+
+type item struct {
+	obj any
+	to  Recycler
+}
+
+// NewCollector returns a collector with no guards.
+func NewCollector() *Collector {
+	c := &Collector{}
+	c.guards.Store(&[]*Guard{})
+	return c
+}
+
+// Pin returns a guard pinned at the current epoch. It must be unpinned by
+// the same goroutine, usually with a deferred Unpin.
+func (c *Collector) Pin() *Guard {
+	g := c.acquire()
+	e := c.epoch.Load()
+	for {
+		g.state.Store(e<<1 | 1)
+		// The epoch may have advanced before the pin became visible; pin
+		// again so the advance cannot have skipped us.
+		now := c.epoch.Load()
+		if now == e {
+			break
+		}
+		e = now
+	}
+	g.collect(e)
+	return g
+}
+
+// acquire takes ownership of a free guard, registering a new one if all are
+// in use.
+func (c *Collector) acquire() *Guard {
+	guards := *c.guards.Load()
+	if n := uint32(len(guards)); n > 0 {
+		start := c.next.Add(1)
+		for i := uint32(0); i < n; i++ {
+			g := guards[(start+i)%n]
+			if !g.owned.Load() && g.owned.CompareAndSwap(false, true) {
+				return g
+			}
+		}
+	}
+
+	g := &Guard{c: c}
+	g.owned.Store(true)
+	c.mu.Lock()
+	grown := append(append([]*Guard(nil), *c.guards.Load()...), g)
+	c.guards.Store(&grown)
+	c.mu.Unlock()
+	return g
+}
+
+// tryAdvance moves the global epoch forward if every pinned guard is pinned
+// at the current one.
+func (c *Collector) tryAdvance() {
+	e := c.epoch.Load()
+	for _, g := range *c.guards.Load() {
+		if s := g.state.Load(); s&1 == 1 && s>>1 != e {
+			return
+		}
+	}
+	c.epoch.CompareAndSwap(e, e+1)
+}
+
+// Unpin releases the guard. Pointers loaded while it was pinned must not be
+// used afterwards.
+func (g *Guard) Unpin() {
+	g.state.Store(0)
+	g.owned.Store(false)
+}
+
+// Retire hands obj, which must already be unreachable for goroutines that
+// pin from now on, to to once no pinned goroutine can still hold it.
+func (g *Guard) Retire(obj any, to Recycler) {
+	e := g.c.epoch.Load()
+	b := &g.bags[e%3]
+	if b.epoch != e {
+		// The bag is at least three epochs old, so it is safe to empty.
+		b.recycle()
+		b.epoch = e
+	}
+	b.items = append(b.items, item{obj: obj, to: to})
+
+	if g.retired++; g.retired%advanceEvery == 0 {
+		g.c.tryAdvance()
+		g.collect(g.c.epoch.Load())
+	}
+}
+
+// collect recycles the bags retired two or more epochs before e.
+func (g *Guard) collect(e uint64) {
+	for i := range g.bags {
+		if b := &g.bags[i]; len(b.items) > 0 && b.epoch+2 <= e {
+			b.recycle()
+		}
+	}
+}
+
+func (b *bag) recycle() {
+	for i, it := range b.items {
+		it.to.Recycle(it.obj)
+		b.items[i] = item{}
+	}
+	b.items = b.items[:0]
+}
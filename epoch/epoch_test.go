@@ -0,0 +1,115 @@
+package epoch
+
+import (
+	"sync"
+	"testing"
+)
+
+type object struct {
+	id int
+}
+
+func TestRetiredObjectsWaitForPinnedGuards(t *testing.T) {
+	c := NewCollector()
+	pool := NewPool[object](func(o *object) { o.id = 0 })
+
+	reader := c.Pin()
+	writer := c.Pin()
+	for i := 1; i <= 10*advanceEvery; i++ {
+		writer.Retire(&object{id: i}, pool)
+	}
+	writer.Unpin()
+	if pool.Len() != 0 {
+		t.Fatalf("Expected nothing recycled while a reader is pinned, Got: %v", pool.Len())
+	}
+
+	// Every guard collects its own retirements when it is next pinned, and
+	// guards are handed out round robin.
+	reader.Unpin()
+	for round := 0; round < 8; round++ {
+		g := c.Pin()
+		for i := 0; i < advanceEvery; i++ {
+			g.Retire(&object{}, pool)
+		}
+		g.Unpin()
+	}
+	if pool.Len() < 10*advanceEvery {
+		t.Errorf("Expected: >= %v, Got: %v", 10*advanceEvery, pool.Len())
+	}
+	if o := pool.Get(); o == nil || o.id != 0 {
+		t.Errorf("Expected a reset object, Got: %v", o)
+	}
+}
+
+func TestGuardsAreReused(t *testing.T) {
+	c := NewCollector()
+	for i := 0; i < 100; i++ {
+		c.Pin().Unpin()
+	}
+	if n := len(*c.guards.Load()); n != 1 {
+		t.Errorf("Expected: %v, Got: %v", 1, n)
+	}
+
+	a, b := c.Pin(), c.Pin()
+	if a == b {
+		t.Errorf("Expected distinct guards for concurrent pins")
+	}
+	a.Unpin()
+	b.Unpin()
+}
+
+func TestPoolGetEmpty(t *testing.T) {
+	pool := NewPool[object](nil)
+	if pool.Get() != nil {
+		t.Errorf("Expected an empty pool")
+	}
+	o := &object{id: 1}
+	pool.Put(o)
+	if got := pool.Get(); got != o {
+		t.Errorf("Expected: %v, Got: %v", o, got)
+	}
+}
+
+// TestNoRecycleWhileReachable publishes objects through a shared slot and
+// checks that a reader never sees one that was recycled under it.
+func TestNoRecycleWhileReachable(t *testing.T) {
+	c := NewCollector()
+	var mu sync.Mutex
+	slot := &object{id: 1}
+	pool := NewPool[object](func(o *object) { o.id = -1 })
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				g := c.Pin()
+				mu.Lock()
+				o := slot
+				mu.Unlock()
+				for j := 0; j < 10; j++ {
+					if o.id <= 0 {
+						t.Errorf("read a recycled object")
+					}
+				}
+				g.Unpin()
+			}
+		}()
+	}
+	for i := 2; i < 5000; i++ {
+		g := c.Pin()
+		o := pool.Get()
+		if o == nil {
+			o = &object{}
+		}
+		o.id = i
+		mu.Lock()
+		old := slot
+		slot = o
+		mu.Unlock()
+		g.Retire(old, pool)
+		g.Unpin()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,56 @@
+package epoch
+
+import "sync"
+
+// Pool is a typed free list of objects that went through a grace period.
+// Unlike sync.Pool it never drops objects, so a list that churns through a
+// steady working set stops allocating.
+type Pool[T any] struct {
+	mu    sync.Mutex
+	free  []*T
+	reset func(*T)
+}
+
+// NewPool returns an empty pool. reset, if not nil, clears an object as it
+// enters the pool so that it does not keep anything else alive.
+func NewPool[T any](reset func(*T)) *Pool[T] {
+	return &Pool[T]{reset: reset}
+}
+
+// Get returns a recycled object, or nil if the pool is empty.
+func (p *Pool[T]) Get() *T {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.free)
+	if n == 0 {
+		return nil
+	}
+	obj := p.free[n-1]
+	p.free[n-1] = nil
+	p.free = p.free[:n-1]
+	return obj
+}
+
+// Put adds obj to the pool right away. It is for objects that were never
+// shared, or whose grace period is known to be over; anything else must be
+// retired on a Guard.
+func (p *Pool[T]) Put(obj *T) {
+	if p.reset != nil {
+		p.reset(obj)
+	}
+	p.mu.Lock()
+	p.free = append(p.free, obj)
+	p.mu.Unlock()
+}
+
+// Recycle implements Recycler. obj must be a *T.
+func (p *Pool[T]) Recycle(obj any) {
+	p.Put(obj.(*T))
+}
+
+// Len returns the number of objects in the pool.
+func (p *Pool[T]) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.free)
+}
@@ -1,6 +1,6 @@
 module skiplist
 
-go 1.20
+go 1.23
 
 require (
 	github.com/petermattis/goid v0.0.0-20240327183114-c42a807a84ba
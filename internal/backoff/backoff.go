@@ -0,0 +1,43 @@
+// Package backoff paces the loops in which the skip lists wait for another
+// goroutine to finish what it is doing, such as an insert that is linking a
+// node. The wait usually takes no longer than the other goroutine holding a
+// lock or running a few instructions, so a Backoff spins briefly, then yields
+// so that the other goroutine can run even with GOMAXPROCS=1, then sleeps,
+// doubling the sleep up to a millisecond. A stalled goroutine thus costs the
+// waiters little CPU, however long it takes.
+package backoff
+
+import (
+	"runtime"
+	"time"
+)
+
+const (
+	spins    = 16
+	yields   = 64
+	maxSleep = time.Millisecond
+)
+
+// Backoff is the state of one wait. The zero value is ready to use.
+type Backoff struct {
+	n     int
+	sleep time.Duration
+}
+
+// Wait pauses before the waiter checks again.
+func (b *Backoff) Wait() {
+	switch {
+	case b.n < spins:
+	case b.n < spins+yields:
+		runtime.Gosched()
+	default:
+		if b.sleep == 0 {
+			b.sleep = time.Microsecond
+		}
+		time.Sleep(b.sleep)
+		if b.sleep < maxSleep {
+			b.sleep *= 2
+		}
+	}
+	b.n++
+}
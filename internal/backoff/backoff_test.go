@@ -0,0 +1,36 @@
+package backoff
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWait tests that a waiter lets the goroutine it waits for run, even
+// with a single P, and that it ends up sleeping rather than spinning.
+func TestWait(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	var done atomic.Bool
+	go done.Store(true)
+	var b Backoff
+	for !done.Load() {
+		b.Wait()
+	}
+
+	b = Backoff{}
+	for i := 0; i < spins+yields; i++ {
+		b.Wait()
+	}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		b.Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Microsecond {
+		t.Fatalf("4 waits past the yields took %v, want sleeps of 1+2+4+8µs", elapsed)
+	}
+	if b.sleep != 16*time.Microsecond {
+		t.Fatalf("next sleep is %v, want 16µs", b.sleep)
+	}
+}
@@ -0,0 +1,68 @@
+// Package setops computes intersections, unions and differences of ordered
+// key sets while streaming over them. Inputs are cursors over skip lists;
+// the operations advance them with Seek, which descends from the upper levels
+// of a list, so runs of keys that cannot contribute to the result are jumped
+// over instead of being walked one by one at level 0.
+//
+// The results are cursors themselves and can be nested. Apart from the result
+// itself, no allocation happens while iterating.
+package setops
+
+import (
+	lazyskiplist "skiplist/b_lazy_lock_skiplist/impl_clear/lazy"
+)
+
+// Cursor is a forward cursor over keys in ascending order, without
+// duplicates. *skiplist.Iterator from a_regular satisfies it, and Lazy adapts
+// a lazyskiplist iterator.
+type Cursor[K any] interface {
+	// Valid returns true iff the cursor is positioned on a key.
+	Valid() bool
+	// Key returns the key at the current position.
+	Key() K
+	// Next advances to the next key.
+	Next()
+	// Seek positions the cursor on the first key >= key and reports whether
+	// it is equal to key. The set operations only seek forward.
+	Seek(key K) bool
+}
+
+// Lazy adapts a lazyskiplist iterator to a Cursor. Keys are compared with the
+// list's comparator, so the same comparator must be passed to the set
+// operation.
+//
+// Stepping the iterator can land on a node that is being added or removed;
+// the cursor passes over such nodes, as the list's own searches do.
+func Lazy[K, V any](it *lazyskiplist.Iterator[K, V]) Cursor[K] {
+	c := lazyCursor[K, V]{it}
+	c.skipAbsent()
+	return c
+}
+
+type lazyCursor[K, V any] struct {
+	it *lazyskiplist.Iterator[K, V]
+}
+
+func (c lazyCursor[K, V]) Valid() bool { return c.it.Present() }
+func (c lazyCursor[K, V]) Key() K      { return c.it.Key() }
+
+func (c lazyCursor[K, V]) Next() {
+	c.it.Next()
+	c.skipAbsent()
+}
+
+func (c lazyCursor[K, V]) Seek(key K) bool {
+	found := c.it.Seek(key)
+	return !c.skipAbsent() && found
+}
+
+// skipAbsent advances the iterator past nodes that are not fully linked or
+// are marked, and reports whether it moved.
+func (c lazyCursor[K, V]) skipAbsent() bool {
+	moved := false
+	for c.it.Present() && (!c.it.IsFullyLinked() || c.it.IsMarked()) {
+		c.it.Next()
+		moved = true
+	}
+	return moved
+}
@@ -0,0 +1,215 @@
+package setops
+
+// IntersectIterator is a Cursor over the keys present in every input. It
+// uses the leapfrog join: the cursor with the smallest key seeks straight to
+// the largest key any cursor is on, until they all agree.
+type IntersectIterator[K any] struct {
+	compare func(a, b K) int
+	cursors []Cursor[K]
+	// p is the cursor to move next; cursors[p-1] holds the largest key.
+	p     int
+	valid bool
+}
+
+// Intersect returns the intersection of the given cursors, which must already
+// be positioned on the first key to consider (e.g. with SeekToFirst).
+func Intersect[K any](compare func(a, b K) int, cursors ...Cursor[K]) *IntersectIterator[K] {
+	it := &IntersectIterator[K]{
+		compare: compare,
+		cursors: append([]Cursor[K](nil), cursors...),
+	}
+	it.init()
+	return it
+}
+
+func (it *IntersectIterator[K]) init() {
+	it.valid = len(it.cursors) > 0
+	for _, c := range it.cursors {
+		if !c.Valid() {
+			it.valid = false
+			return
+		}
+	}
+
+	// Order the cursors by key so that the leapfrog invariant holds.
+	for i := 1; i < len(it.cursors); i++ {
+		for j := i; j > 0 && it.compare(it.cursors[j].Key(), it.cursors[j-1].Key()) < 0; j-- {
+			it.cursors[j], it.cursors[j-1] = it.cursors[j-1], it.cursors[j]
+		}
+	}
+	it.p = 0
+	it.search()
+}
+
+func (it *IntersectIterator[K]) search() {
+	n := len(it.cursors)
+	max := it.cursors[(it.p+n-1)%n].Key()
+	for {
+		c := it.cursors[it.p]
+		if it.compare(c.Key(), max) == 0 {
+			// Every cursor is between min and max, so all are equal.
+			return
+		}
+		c.Seek(max)
+		if !c.Valid() {
+			it.valid = false
+			return
+		}
+		max = c.Key()
+		it.p = (it.p + 1) % n
+	}
+}
+
+// Valid returns true iff the intersection is positioned on a key.
+func (it *IntersectIterator[K]) Valid() bool { return it.valid }
+
+// Key returns the current key. Every input cursor is positioned on it.
+func (it *IntersectIterator[K]) Key() K { return it.cursors[0].Key() }
+
+// Next advances to the next common key.
+func (it *IntersectIterator[K]) Next() {
+	c := it.cursors[it.p]
+	c.Next()
+	if !c.Valid() {
+		it.valid = false
+		return
+	}
+	it.p = (it.p + 1) % len(it.cursors)
+	it.search()
+}
+
+// Seek positions the intersection on the first common key >= key.
+func (it *IntersectIterator[K]) Seek(key K) bool {
+	for _, c := range it.cursors {
+		if c.Valid() && it.compare(c.Key(), key) < 0 {
+			c.Seek(key)
+		}
+	}
+	it.init()
+	return it.valid && it.compare(it.Key(), key) == 0
+}
+
+// UnionIterator is a Cursor over the keys present in any input, each
+// reported once.
+type UnionIterator[K any] struct {
+	compare func(a, b K) int
+	cursors []Cursor[K]
+	min     Cursor[K]
+}
+
+// Union returns the union of the given cursors, which must already be
+// positioned on the first key to consider.
+func Union[K any](compare func(a, b K) int, cursors ...Cursor[K]) *UnionIterator[K] {
+	it := &UnionIterator[K]{
+		compare: compare,
+		cursors: append([]Cursor[K](nil), cursors...),
+	}
+	it.findMin()
+	return it
+}
+
+func (it *UnionIterator[K]) findMin() {
+	it.min = nil
+	for _, c := range it.cursors {
+		if c.Valid() && (it.min == nil || it.compare(c.Key(), it.min.Key()) < 0) {
+			it.min = c
+		}
+	}
+}
+
+// Valid returns true iff the union is positioned on a key.
+func (it *UnionIterator[K]) Valid() bool { return it.min != nil }
+
+// Key returns the current key.
+func (it *UnionIterator[K]) Key() K { return it.min.Key() }
+
+// Next advances every input positioned on the current key and moves to the
+// smallest key that remains.
+func (it *UnionIterator[K]) Next() {
+	key := it.min.Key()
+	for _, c := range it.cursors {
+		if c.Valid() && it.compare(c.Key(), key) == 0 {
+			c.Next()
+		}
+	}
+	it.findMin()
+}
+
+// Seek positions the union on the first key >= key.
+func (it *UnionIterator[K]) Seek(key K) bool {
+	for _, c := range it.cursors {
+		if c.Valid() && it.compare(c.Key(), key) < 0 {
+			c.Seek(key)
+		}
+	}
+	it.findMin()
+	return it.Valid() && it.compare(it.Key(), key) == 0
+}
+
+// DifferenceIterator is a Cursor over the keys of one input that are absent
+// from all the others. The excluded inputs are only ever advanced by seeking
+// to the current candidate.
+type DifferenceIterator[K any] struct {
+	compare func(a, b K) int
+	from    Cursor[K]
+	minus   []Cursor[K]
+}
+
+// Difference returns the keys of from that are in none of minus. All cursors
+// must already be positioned on the first key to consider.
+func Difference[K any](compare func(a, b K) int, from Cursor[K], minus ...Cursor[K]) *DifferenceIterator[K] {
+	it := &DifferenceIterator[K]{
+		compare: compare,
+		from:    from,
+		minus:   append([]Cursor[K](nil), minus...),
+	}
+	it.skipExcluded()
+	return it
+}
+
+func (it *DifferenceIterator[K]) skipExcluded() {
+	for it.from.Valid() && it.excluded(it.from.Key()) {
+		it.from.Next()
+	}
+}
+
+func (it *DifferenceIterator[K]) excluded(key K) bool {
+	for _, c := range it.minus {
+		if !c.Valid() {
+			continue
+		}
+		cmp := it.compare(c.Key(), key)
+		if cmp < 0 {
+			c.Seek(key)
+			if !c.Valid() {
+				continue
+			}
+			cmp = it.compare(c.Key(), key)
+		}
+		if cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid returns true iff the difference is positioned on a key.
+func (it *DifferenceIterator[K]) Valid() bool { return it.from.Valid() }
+
+// Key returns the current key.
+func (it *DifferenceIterator[K]) Key() K { return it.from.Key() }
+
+// Next advances to the next key that is not excluded.
+func (it *DifferenceIterator[K]) Next() {
+	it.from.Next()
+	it.skipExcluded()
+}
+
+// Seek positions the difference on the first key >= key.
+func (it *DifferenceIterator[K]) Seek(key K) bool {
+	if it.from.Valid() && it.compare(it.from.Key(), key) < 0 {
+		it.from.Seek(key)
+	}
+	it.skipExcluded()
+	return it.Valid() && it.compare(it.Key(), key) == 0
+}
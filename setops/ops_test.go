@@ -0,0 +1,220 @@
+package setops
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	skiplist "skiplist/a_regular"
+	lazyskiplist "skiplist/b_lazy_lock_skiplist/impl_clear/lazy"
+	"skiplist/b_lazy_lock_skiplist/impl_clear/lib"
+)
+
+func intCompare(a, b int) int { return a - b }
+
+func newList(keys ...int) *skiplist.SkipList[int, struct{}] {
+	sl := skiplist.New[int, struct{}](intCompare)
+	for _, k := range keys {
+		sl.Set(k, struct{}{})
+	}
+	return sl
+}
+
+func first(sl *skiplist.SkipList[int, struct{}]) *skiplist.Iterator[int, struct{}] {
+	it := sl.Iterator()
+	it.SeekToFirst()
+	return it
+}
+
+func drain[K any](c Cursor[K]) []K {
+	var keys []K
+	for ; c.Valid(); c.Next() {
+		keys = append(keys, c.Key())
+	}
+	return keys
+}
+
+// countingCursor counts how often the wrapped cursor is stepped.
+type countingCursor[K any] struct {
+	Cursor[K]
+	nexts int
+}
+
+func (c *countingCursor[K]) Next() {
+	c.nexts++
+	c.Cursor.Next()
+}
+
+func TestIntersect(t *testing.T) {
+	a := newList(1, 2, 3, 5, 8, 13, 21)
+	b := newList(2, 3, 5, 7, 11, 13)
+	c := newList(0, 3, 5, 13, 100)
+
+	got := drain[int](Intersect[int](intCompare, first(a), first(b), first(c)))
+	if expected := []int{3, 5, 13}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+
+	got = drain[int](Intersect[int](intCompare, first(a), first(newList())))
+	if got != nil {
+		t.Errorf("Expected: %v, Got: %v", nil, got)
+	}
+}
+
+func TestIntersectSkips(t *testing.T) {
+	var keys []int
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, i)
+	}
+	big := newList(keys...)
+	small := newList(10, 50000, 99999)
+
+	counted := &countingCursor[int]{Cursor: first(big)}
+	got := drain[int](Intersect[int](intCompare, counted, first(small)))
+	if expected := []int{10, 50000, 99999}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+	if counted.nexts > 10 {
+		t.Errorf("Expected the large list to be sought, not walked: %d steps", counted.nexts)
+	}
+}
+
+func TestUnionAndDifference(t *testing.T) {
+	a := newList(1, 4, 6, 9)
+	b := newList(2, 4, 9, 10)
+	c := newList(0, 6)
+
+	got := drain[int](Union[int](intCompare, first(a), first(b), first(c)))
+	if expected := []int{0, 1, 2, 4, 6, 9, 10}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+
+	got = drain[int](Difference[int](intCompare, first(a), first(b), first(c)))
+	if expected := []int{1}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+
+	got = drain[int](Difference[int](intCompare, first(b)))
+	if expected := []int{2, 4, 9, 10}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+}
+
+func TestNestedAndSeek(t *testing.T) {
+	a := newList(1, 2, 3, 4, 5, 6)
+	b := newList(2, 4, 6)
+	c := newList(3, 6)
+
+	// (b ∪ c) ∩ a, positioned past the first matches.
+	it := Intersect[int](intCompare, Union[int](intCompare, first(b), first(c)), first(a))
+	if !it.Seek(4) {
+		t.Errorf("Expected Seek(4) to land on 4")
+	}
+	got := drain[int](it)
+	if expected := []int{4, 6}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+}
+
+func TestRandomized(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	sets := make([]map[int]bool, 3)
+	lists := make([]*skiplist.SkipList[int, struct{}], 3)
+	for i := range sets {
+		sets[i] = map[int]bool{}
+		lists[i] = newList()
+		for j := 0; j < 2000; j++ {
+			k := rng.Intn(3000)
+			sets[i][k] = true
+			lists[i].Set(k, struct{}{})
+		}
+	}
+
+	var inter, union, diff []int
+	for k := 0; k < 3000; k++ {
+		a, b, c := sets[0][k], sets[1][k], sets[2][k]
+		if a && b && c {
+			inter = append(inter, k)
+		}
+		if a || b || c {
+			union = append(union, k)
+		}
+		if a && !b && !c {
+			diff = append(diff, k)
+		}
+	}
+
+	if got := drain[int](Intersect[int](intCompare, first(lists[0]), first(lists[1]), first(lists[2]))); !reflect.DeepEqual(inter, got) {
+		t.Errorf("intersection mismatch")
+	}
+	if got := drain[int](Union[int](intCompare, first(lists[0]), first(lists[1]), first(lists[2]))); !reflect.DeepEqual(union, got) {
+		t.Errorf("union mismatch")
+	}
+	if got := drain[int](Difference[int](intCompare, first(lists[0]), first(lists[1]), first(lists[2]))); !reflect.DeepEqual(diff, got) {
+		t.Errorf("difference mismatch")
+	}
+}
+
+func TestLazy(t *testing.T) {
+	newLazy := func(keys ...int) Cursor[int] {
+		list := lazyskiplist.NewLazySkipList[int, struct{}](lib.IntComparator)
+		for _, k := range keys {
+			list.Put(k, struct{}{}, nil)
+		}
+		return Lazy(list.First())
+	}
+
+	var got []int
+	it := Intersect[int](lib.IntComparator, newLazy(5, 1, 3, 7), newLazy(3, 4, 5, 6, 7))
+	for ; it.Valid(); it.Next() {
+		got = append(got, it.Key())
+	}
+	if expected := []int{3, 5, 7}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+
+	got = nil
+	u := Union[int](lib.IntComparator, newLazy(5, 1), newLazy(2, 5))
+	for ; u.Valid(); u.Next() {
+		got = append(got, u.Key())
+	}
+	if !sort.IntsAreSorted(got) || len(got) != 3 {
+		t.Errorf("Expected: %v, Got: %v", []int{1, 2, 5}, got)
+	}
+}
+
+func TestLazyRemoveWhileWalking(t *testing.T) {
+	list := lazyskiplist.NewLazySkipList[int, struct{}](lib.IntComparator)
+	for k := 1; k <= 6; k++ {
+		list.Put(k, struct{}{}, nil)
+	}
+
+	// A removed node keeps its links, so the cursor on 2 still leads to 3
+	// after both are removed; it must pass over 3.
+	var got []int
+	it := Intersect[int](lib.IntComparator, Lazy(list.First()), first(newList(1, 2, 3, 4, 5, 6)))
+	for ; it.Valid(); it.Next() {
+		got = append(got, it.Key())
+		if it.Key() == 2 {
+			list.Remove(2)
+			list.Remove(3)
+		}
+	}
+	if expected := []int{1, 2, 4, 5, 6}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+
+	c := Lazy(list.First())
+	c.Next()
+	list.Remove(4)
+	list.Remove(5)
+	c.Next()
+	if !c.Valid() || c.Key() != 6 {
+		t.Errorf("Expected the cursor to pass over removed keys to 6")
+	}
+	c.Next()
+	if c.Valid() {
+		t.Errorf("Expected the cursor to be done")
+	}
+}